@@ -2,19 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 	"titan/internal/actions"
+	"titan/internal/admin"
+	"titan/internal/certs"
 	"titan/internal/core"
+	"titan/internal/events"
+	"titan/internal/history"
+	"titan/internal/prometheus"
 	"titan/internal/proxy"
+	"titan/internal/reload"
 	"titan/internal/tasks"
+	"titan/internal/tui"
 	"titan/internal/utils"
+	"titan/pkg/config"
 	"titan/pkg/flags"
 	"titan/pkg/types"
 
@@ -22,28 +36,38 @@ import (
 )
 
 func main() {
-	w := os.Stderr
-
-	// logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	// slog.SetDefault(logger)
-	logger := slog.New(tint.NewHandler(w, nil))
-	// Set global logger with custom options
-	slog.SetDefault(slog.New(
-		tint.NewHandler(w, &tint.Options{
-			Level:      slog.LevelDebug,
-			TimeFormat: time.Kitchen,
-		}),
-	))
+	// Logger used until the configured one is set up by the container
+	logger := slog.New(tint.NewHandler(os.Stderr, &tint.Options{
+		TimeFormat: time.Kitchen,
+	}))
+	slog.SetDefault(logger)
+
+	// Logging flags, filled when parsing the command flags
+	var logFlags types.Logging
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	repoRunner := func(action types.Action) func(vars ...any) error {
 		return func(vars ...any) error {
+			repoFlags := vars[1].(flags.RepoFlags)
+			output, err := events.ParseFormat(repoFlags.Output)
+			if err != nil {
+				return err
+			}
 			options := core.ContainerOptions{
-				Logger:        logger,
-				CommandAction: action,
-				ConfigPath:    vars[0].(string),
+				Logger:          logger,
+				Logging:         logFlags,
+				CommandAction:   action,
+				ConfigPath:      vars[0].(string),
+				AutoStash:       repoFlags.AutoStash,
+				Jobs:            repoFlags.Jobs,
+				Only:            repoFlags.Only,
+				Branch:          repoFlags.Branch,
+				Create:          repoFlags.Create,
+				Force:           repoFlags.Force,
+				Output:          output,
+				SkipEnvironment: action == utils.STATUS || action == utils.CLONE || action == utils.CHECKOUT,
 			}
 			container := core.NewContainer(options)
 
@@ -52,26 +76,100 @@ func main() {
 		}
 	}
 	commandOptions := flags.AppCommandsOptions{
+		Logging: &logFlags,
 		Commands: map[string]flags.Command{
-			"fetch":   {Runner: repoRunner(utils.FETCH)},
-			"install": {Runner: repoRunner(utils.INSTALL)},
-			"build":   {Runner: repoRunner(utils.BUILD)},
-			"clean":   {Runner: repoRunner(utils.CLEAN)},
-			"all":     {Runner: repoRunner(utils.REPO_ALL)},
+			"fetch":     {Runner: repoRunner(utils.FETCH)},
+			"install":   {Runner: repoRunner(utils.INSTALL)},
+			"build":     {Runner: repoRunner(utils.BUILD)},
+			"clean":     {Runner: repoRunner(utils.CLEAN)},
+			"all":       {Runner: repoRunner(utils.REPO_ALL)},
+			"status":    {Runner: repoRunner(utils.STATUS)},
+			"clone":     {Runner: repoRunner(utils.CLONE)},
+			"bootstrap": {Runner: repoRunner(utils.BOOTSTRAP)},
+			"checkout":  {Runner: repoRunner(utils.CHECKOUT)},
+			"history": {
+				Runner: func(vars ...any) error {
+					options := core.ContainerOptions{
+						Logger:          logger,
+						Logging:         logFlags,
+						CommandAction:   utils.HISTORY,
+						ConfigPath:      vars[0].(string),
+						SkipEnvironment: true,
+					}
+					container := core.NewContainer(options)
+
+					processHistory(container, vars[1].(flags.HistoryFlags))
+					return nil
+				},
+			},
 			"serve": {
 				Runner: func(vars ...any) error {
+					serveFlags := vars[2].(flags.ServeFlags)
+					output, err := events.ParseFormat(serveFlags.Output)
+					if err != nil {
+						return err
+					}
 					options := core.ContainerOptions{
 						Logger:        logger,
+						Logging:       logFlags,
 						CommandAction: utils.PROXY_SERVER,
 						Profile:       vars[1].(string),
 						ConfigPath:    vars[0].(string),
+						Output:        output,
+					}
+					// The terminal UI shows the logs itself
+					var ui *tui.TUI
+					if serveFlags.TUI {
+						if output != events.TEXT {
+							return errors.New("the terminal UI cannot be used with a structured output")
+						}
+						if err := tui.Supported(); err != nil {
+							return err
+						}
+						ui = tui.New(options.Profile)
+						options.LogOutput = ui.LogOutput()
 					}
 					container := core.NewContainer(options)
 
-					processProxy(ctx, container)
+					processProxy(ctx, container, serveFlags.Watch, ui)
 					return nil
 				},
 			},
+			"validate": {
+				Runner: func(vars ...any) error {
+					validateFlags := vars[1].(flags.ValidateFlags)
+					output, err := events.ParseFormat(validateFlags.Output)
+					if err != nil {
+						return err
+					}
+					options := core.ContainerOptions{
+						Logger:          logger,
+						Logging:         logFlags,
+						CommandAction:   utils.VALIDATE,
+						ConfigPath:      vars[0].(string),
+						Output:          output,
+						SkipEnvironment: true,
+					}
+					container := core.NewContainer(options)
+
+					processValidate(container)
+					return nil
+				},
+			},
+			"certs": {
+				Runner: func(vars ...any) error {
+					options := core.ContainerOptions{
+						Logger:          logger,
+						Logging:         logFlags,
+						CommandAction:   utils.CERTS,
+						ConfigPath:      vars[0].(string),
+						SkipEnvironment: true,
+					}
+					container := core.NewContainer(options)
+
+					return processCerts(container, vars[1].(flags.CertsFlags))
+				},
+			},
 			"help": {
 				Runner: func(_ ...any) error {
 					utils.PrintlnWhite("TITAN - Wee CLI app that allows perform some operations against a project as well as start a proxy server")
@@ -83,7 +181,21 @@ func main() {
 					utils.PrintlnGreen("   build   - performs a pnpm run build:local on the configured project/s")
 					utils.PrintlnGreen("   clean   - performs a clean up of the node_modules and dist folders on the configured project/s")
 					utils.PrintlnGreen("   all     - performs all of the above")
+					utils.PrintlnGreen("   status  - shows the git status of the configured project/s without fetching")
+					utils.PrintlnGreen("   clone   - clones the configured project/s missing on disk from their remote")
+					utils.PrintlnGreen("   bootstrap - clones the missing project/s and performs a pnpm install on them")
+					utils.PrintlnGreen("   checkout <branch> - switches the configured project/s to the branch. Use \"--create\" to create it where missing")
+					utils.PrintlnGreen("   history - lists the previous runs of the repository commands. Use \"-run <id>\" to see one in detail")
+					utils.PrintlnGreen("             or \"-compare <command>\" to compare the durations of its latest run with the previous ones")
 					utils.PrintlnGreen("   serve   - starts a proxy server based on configuration. NOTE: required flag \"-p\" to specify a profile to use")
+					utils.PrintlnGreen("             Changes to the configuration file are applied while running unless \"-watch=false\" is used")
+					utils.PrintlnGreen("             Use \"--tui\" for an interactive terminal UI with the tasks, their logs and the routes")
+					utils.PrintlnGreen("   validate - checks the configuration file for missing or inconsistent values")
+					utils.PrintlnGreen("   certs   - creates the local CA and issues the proxy certificate. Use \"-export <path>\" to copy the")
+					utils.PrintlnGreen("             CA certificate and \"-renew\" to issue a new certificate")
+					utils.PrintlnBlack("")
+					utils.PrintlnCyan("Repository commands accept \"--only\" with a comma separated list of repository names to run only on those")
+					utils.PrintlnCyan("Repository commands, serve and validate accept \"--output json|ndjson\" to print machine readable events")
 					utils.PrintlnBlack("")
 					utils.PrintlnCyan("To run any of the comands, it requires a configuration file (default \"titan.yaml\" in the same place where the")
 					utils.PrintlnCyan("binary is run). Using the -c flag, we can specify a different config file location")
@@ -99,19 +211,21 @@ func main() {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		sig := <-sigCh
-		logger.Info("inititation shutdown - received signal", "signal", sig)
+		slog.Info("inititation shutdown - received signal", "signal", sig)
 		cancel()
 	}()
 
 	appComands := flags.NewAppCommands(&commandOptions)
 	err := appComands.Run()
 	if err != nil {
-		logger.Error("failed parsing flags", "error", err)
+		slog.Error("failed running command", "error", err)
 		os.Exit(1)
 	}
 }
 
-func processProxy(ctx context.Context, container *core.Container) {
+func processProxy(ctx context.Context, container *core.Container, watch bool, ui *tui.TUI) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	// Create unbuffered error channel for proxy server and tasks
 	errorChannel := make(chan error)
@@ -125,39 +239,123 @@ func processProxy(ctx context.Context, container *core.Container) {
 	container.ConfigData.Profile = profileData
 
 	// Start tasks
-	tasks.StartTasks(errorChannel, container)
+	taskManager := tasks.NewManager(errorChannel, container)
+	if ui != nil {
+		// Their output is shown on the terminal UI
+		taskManager.SetOutput(io.Discard)
+	}
+	if _, err := taskManager.Apply(container.ConfigData.Config, profileData); err != nil {
+		container.Logger.Error("failed starting tasks", "error", err)
+		os.Exit(1)
+	}
 	// Start proxy
-	proxy.StartProxy(errorChannel, container)
+	server, err := proxy.StartProxy(errorChannel, container, taskManager)
+	if err != nil {
+		container.Logger.Error("failed starting proxy", "error", err)
+		taskManager.StopAll()
+		os.Exit(1)
+	}
+	// Start the admin API and dashboard, if configured
+	admin.Start(errorChannel, container, admin.NewServer(server, taskManager))
+	// Start the Prometheus metrics endpoint, if configured
+	prometheus.Start(errorChannel, container, prometheus.Handler(server, taskManager))
+	// Apply the changes of the config file while running
+	if watch {
+		go reload.NewWatcher(container, server, taskManager).Watch(ctx)
+	}
+	// Show the terminal UI until shutting down
+	uiDone := make(chan struct{})
+	go func() {
+		defer close(uiDone)
+		if ui == nil {
+			return
+		}
+		if err := ui.Run(ctx, cancel, server, taskManager); err != nil {
+			select {
+			case errorChannel <- err:
+			case <-ctx.Done():
+			}
+		}
+	}()
 
 	// Wait for error or shutdown
+	stopped := events.Event{Type: events.SERVER_STOPPED}
+	var fatalErr error
 	select {
-	case err := <-errorChannel:
-		container.Logger.Error("fatal error", "error", err)
+	case fatalErr = <-errorChannel:
 	case <-ctx.Done():
+	}
+	// Restore the terminal before logging, so the rest of logs are shown
+	cancel()
+	<-uiDone
+	if fatalErr != nil {
+		container.Logger.Error("fatal error", "error", fatalErr)
+		stopped.Error = fatalErr.Error()
+	} else {
 		container.Logger.Info("context canceled, shutting down")
 	}
+	taskManager.StopAll()
+	if err := server.FlushRecordings(); err != nil {
+		container.Logger.Error("failed writing recorded requests", "error", err)
+	}
 	container.Logger.Info("all workers have stopped")
+	container.Events.Emit(stopped)
+	if err := container.Events.Flush(); err != nil {
+		container.Logger.Error("failed writing output", "error", err)
+	}
+}
+
+func processValidate(container *core.Container) {
+	issues := config.Validate(container.ConfigData.Config)
+	for _, issue := range issues {
+		container.Events.Emit(events.Event{Type: events.VALIDATION_ISSUE, Error: issue.Error()})
+	}
+	container.Events.Emit(events.Event{Type: events.VALIDATION_FINISHED, State: validationState(issues)})
+	if err := container.Events.Flush(); err != nil {
+		container.Logger.Error("failed writing output", "error", err)
+	}
+
+	if !container.Events.Structured() {
+		if len(issues) == 0 {
+			utils.PrintlnGreen(fmt.Sprintf("configuration file %v is valid", container.ConfigData.ConfigFilePath))
+		}
+		for _, issue := range issues {
+			utils.PrintlnRed(fmt.Sprintf("  - %v", issue))
+		}
+	}
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+}
+
+func validationState(issues []error) string {
+	if len(issues) > 0 {
+		return "invalid"
+	}
+	return "valid"
 }
 
 func processCommand(container *core.Container) {
 	// Create a WaitGroup to wait for all workers to finish
 	var wg sync.WaitGroup
 
-	// Channel to do not get stuck in the select below if the error or signal channels do not receive anything
-	// but the repository commands are finished
-	waitCh := make(chan struct{})
-
-	// Create buffered error channel for repository actions
+	// Create buffered error channel for repository actions. Each repository reports one error at most
 	errorChannel := make(chan error, len(container.ConfigData.Config.RepoActions.Repositories))
 
 	// Slice with all the available actions
 	availableActions := []actions.Action{
+		actions.NewCloneAction(),
 		actions.NewFetchAction(),
 		actions.NewCleanAction(),
 		actions.NewInstallAction(),
 		actions.NewBuildAction(),
+		actions.NewStatusAction(),
+		actions.NewCheckoutAction(),
 	}
 
+	// Git status of the repositories, filled by the actions that inspect them
+	report := actions.NewReport()
+
 	// Get only actions required based on command passed to the Titan
 	var actionsToRun []actions.Action
 	for _, actionToCheck := range availableActions {
@@ -166,25 +364,78 @@ func processCommand(container *core.Container) {
 		}
 	}
 
+	// Limit how many repositories are processed at the same time, if requested. The limit covers all the actions
+	// run on a repository, like the clone and install of bootstrap
+	var semaphore chan struct{}
+	if container.Command.Jobs > 0 {
+		semaphore = make(chan struct{}, container.Command.Jobs)
+	}
+
+	// Select the repositories to run the actions on
+	repositories, err := selectRepositories(container.ConfigData.Config.RepoActions.Repositories, container.Command.Only)
+	if err != nil {
+		container.Logger.Error("failed selecting repositories", "error", err)
+		os.Exit(1)
+	}
+
+	// Record of this run, persisted once all actions finish
+	run := history.NewRun(string(container.Command.Action), slices.Sorted(maps.Keys(repositories)))
+	stateDir := container.ConfigData.StateDir()
+	store := history.NewStore(stateDir)
+	container.Events.Emit(events.Event{Type: events.RUN_STARTED, Command: run.Command, Data: run.Repositories})
+
 	// Run actions concurrently for each repo
-	for _, repository := range container.ConfigData.Config.RepoActions.Repositories {
+	for name, repository := range repositories {
 		wg.Go(func() {
-			repoName := repoName(repository)
+			if semaphore != nil {
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+			}
+			repoName := repoName(repository.Path)
 			repositoryActionsConfig := container.ConfigData.Config.RepoActions.Actions
 			scriptsOutput := container.ConfigData.Config.RepoActions.ScriptsOutput
 			sharedEnv := container.SharedEnvironment
 			// Run actions one after the other. Those should be ordered in the array
 			for _, actionToRun := range actionsToRun {
 				repoAction := repositoryActionsConfig[actionToRun.Name()]
+				var logPath string
+				if scriptsOutput == "file" {
+					logPath = filepath.Join(store.LogsDir(run.ID), fmt.Sprintf("%v-%v.log", name, actionToRun.Name()))
+				}
 				options := actions.NewExecOptions(
 					container.Logger,
 					sharedEnv,
 					repoAction,
 					repository,
+					name,
 					repoName,
 					scriptsOutput,
+					container.Command,
+					filepath.Join(stateDir, "cache"),
+					logPath,
+					report,
 				)
+				container.Events.Emit(events.Event{Type: events.ACTION_STARTED, Repository: name, Action: actionToRun.Name()})
+				start := time.Now()
 				err := actionToRun.Execute(options)
+				duration := time.Since(start)
+				finished := events.Event{Type: events.ACTION_FINISHED, Repository: name, Action: actionToRun.Name()}
+				if err != nil {
+					finished.Error = err.Error()
+				}
+				container.Events.Emit(finished.WithExitCode(exitCode(err)).WithDuration(duration))
+				record := history.ActionRecord{
+					Repository: name,
+					Action:     actionToRun.Name(),
+					Duration:   duration,
+					ExitCode:   exitCode(err),
+					LogPath:    logPath,
+					Skipped:    err == nil && options.Skipped(),
+				}
+				if err != nil {
+					record.Error = err.Error()
+				}
+				run.Add(record)
 				if err != nil {
 					errorChannel <- err
 					// Stop procession further actions
@@ -194,26 +445,33 @@ func processCommand(container *core.Container) {
 		})
 	}
 
-	// Wait for all workers to finish
+	// Wait for all workers to finish, then collect every error they reported
 	wg.Wait()
-	close(waitCh)
-
-	// Select loop to wait for signals or errors
-	select {
-	case <-waitCh:
-		container.Logger.Debug("waitGroup finished")
-	case err := <-errorChannel:
-		container.Logger.Error("fatal error", "error", err)
-		// cancel() // Cancel the context to stop the workers
-	}
-
 	close(errorChannel)
-
 	var errors []error
 	for err := range errorChannel {
 		errors = append(errors, err)
 	}
 
+	if container.Events.Structured() {
+		report.Emit(container.Events)
+	} else {
+		report.Print()
+	}
+
+	if len(errors) > 0 {
+		run.Finish(1)
+	} else {
+		run.Finish(0)
+	}
+	if err := store.Append(run); err != nil {
+		container.Logger.Warn("failed saving run history", "error", err)
+	}
+	container.Events.Emit(events.Event{Type: events.RUN_FINISHED, Command: run.Command}.WithExitCode(run.ExitCode).WithDuration(run.Duration))
+	if err := container.Events.Flush(); err != nil {
+		container.Logger.Error("failed writing output", "error", err)
+	}
+
 	if len(errors) > 0 {
 		container.Logger.Error("some actions failed:")
 		for _, err := range errors {
@@ -224,6 +482,114 @@ func processCommand(container *core.Container) {
 		container.Logger.Debug("all actions completed")
 	}
 }
+
+func processCerts(container *core.Container, certsFlags flags.CertsFlags) error {
+	ssl := container.ConfigData.Config.Server.SSL
+	authority := certs.NewAuthority(certs.Dir(container.ConfigData.StateDir()))
+	hosts := certs.Hosts(container.ConfigData.Config.Server.Host, ssl.SANs)
+	cert, err := authority.Ensure(hosts, certsFlags.Renew)
+	if err != nil {
+		return err
+	}
+
+	caPath := authority.CAPath()
+	if certsFlags.Export != "" {
+		data, err := os.ReadFile(caPath)
+		if err != nil {
+			return fmt.Errorf("failed reading local CA certificate: %w", err)
+		}
+		if err := os.WriteFile(certsFlags.Export, data, 0644); err != nil {
+			return fmt.Errorf("failed exporting local CA certificate: %w", err)
+		}
+		caPath = certsFlags.Export
+	}
+
+	utils.PrintlnGreen(fmt.Sprintf("CA certificate:  %v", caPath))
+	utils.PrintlnGreen(fmt.Sprintf("certificate:     %v", authority.CertPath()))
+	utils.PrintlnGreen(fmt.Sprintf("hosts:           %v", strings.Join(hosts, ", ")))
+	utils.PrintlnGreen(fmt.Sprintf("expires:         %v", cert.NotAfter.Format(time.DateOnly)))
+	utils.PrintlnBlack("")
+	if !ssl.Auto {
+		utils.PrintlnCyan("Set \"server.ssl.auto: true\" in the configuration file so serve uses the issued certificate")
+	}
+	utils.PrintlnCyan("Trust the CA certificate once so browsers accept the certificate:")
+	utils.PrintlnCyan(fmt.Sprintf("   macOS:   sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %v", caPath))
+	utils.PrintlnCyan(fmt.Sprintf("   Linux:   sudo cp %v /usr/local/share/ca-certificates/titan.crt && sudo update-ca-certificates", caPath))
+	utils.PrintlnCyan(fmt.Sprintf("   Windows: certutil -addstore -f ROOT %v", caPath))
+	utils.PrintlnCyan("Firefox keeps its own store, import the CA certificate from its settings under Certificates")
+	return nil
+}
+
+func processHistory(container *core.Container, historyFlags flags.HistoryFlags) {
+	runs, err := history.NewStore(container.ConfigData.StateDir()).Load()
+	if err != nil {
+		container.Logger.Error("failed loading run history", "error", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case historyFlags.Run != "":
+		for _, run := range runs {
+			if run.ID == historyFlags.Run {
+				history.PrintRun(run)
+				return
+			}
+		}
+		container.Logger.Error("run not found in history", "id", historyFlags.Run)
+		os.Exit(1)
+	case historyFlags.Compare != "":
+		var commandRuns []*history.Run
+		for _, run := range runs {
+			if run.Command == historyFlags.Compare {
+				commandRuns = append(commandRuns, run)
+			}
+		}
+		if len(commandRuns) == 0 {
+			container.Logger.Error("no runs found in history for command", "command", historyFlags.Compare)
+			os.Exit(1)
+		}
+		history.PrintComparison(commandRuns)
+	default:
+		if historyFlags.Failed {
+			runs = slices.DeleteFunc(runs, func(run *history.Run) bool {
+				return !run.Failed()
+			})
+		}
+		if historyFlags.Limit > 0 && len(runs) > historyFlags.Limit {
+			runs = runs[len(runs)-historyFlags.Limit:]
+		}
+		history.PrintRuns(runs)
+	}
+}
+
+// exitCode returns the exit code of the script that caused the error, 1 if it is not a script error
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// selectRepositories returns the configured repositories restricted to the given names, if any
+func selectRepositories(repositories map[string]types.Repository, only []string) (map[string]types.Repository, error) {
+	if len(only) == 0 {
+		return repositories, nil
+	}
+	selected := make(map[string]types.Repository, len(only))
+	for _, name := range only {
+		repository, found := repositories[name]
+		if !found {
+			return nil, fmt.Errorf("repository [%v] not found in config", name)
+		}
+		selected[name] = repository
+	}
+	return selected, nil
+}
+
 func repoName(repository string) string {
 	split := strings.Split(repository, "/")
 	return split[len(split)-1]
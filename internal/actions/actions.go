@@ -1,9 +1,17 @@
 package actions
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
+	"titan/internal/cache"
+	"titan/internal/core"
+	"titan/internal/events"
 	"titan/internal/utils"
 	"titan/pkg/parser"
 	"titan/pkg/types"
@@ -12,30 +20,63 @@ import (
 type ExecOptions struct {
 	logger        *slog.Logger
 	repoAction    *types.RepoAction
+	repository    types.Repository
 	repoPath      string
+	name          string
 	projectName   string
 	env           []string
 	scriptsOutput string
+	autoStash     bool
+	branch        string
+	createBranch  bool
+	force         bool
+	cacheDir      string
+	logPath       string
+	structured    bool
+	report        *Report
+	skipped       bool
 }
 
+// NewExecOptions returns the options of an action on a repository. The name of the repository in the configuration
+// keys its cache and report, as several of them may share the folder projectName is taken from
 func NewExecOptions(
 	logger *slog.Logger,
 	env []string,
 	repoAction *types.RepoAction,
-	repoPath string,
+	repository types.Repository,
+	name string,
 	projectName string,
 	scriptsOutput string,
+	command core.Command,
+	cacheDir string,
+	logPath string,
+	report *Report,
 ) *ExecOptions {
 	return &ExecOptions{
 		logger:        logger,
 		env:           env,
 		repoAction:    repoAction,
-		repoPath:      repoPath,
+		repository:    repository,
+		repoPath:      repository.Path,
+		name:          name,
 		projectName:   projectName,
 		scriptsOutput: scriptsOutput,
+		autoStash:     command.AutoStash,
+		branch:        command.Branch,
+		createBranch:  command.Create,
+		force:         command.Force,
+		cacheDir:      cacheDir,
+		logPath:       logPath,
+		structured:    command.Output != events.TEXT,
+		report:        report,
 	}
 }
 
+// Skipped indicates the action had nothing to do, like when its cached inputs did not change
+func (o *ExecOptions) Skipped() bool {
+	return o.skipped
+}
+
 // Action defines what an action is
 type Action interface {
 	// Name gives the name of the action
@@ -70,7 +111,7 @@ func getScriptFromConfig(actionName string, repoAction *types.RepoAction, parser
 	return sb.String()
 }
 
-func executeScript(actionName string, scriptFromConfig string, logger *slog.Logger, repoPath string, projectName string, env []string) error {
+func executeScript(actionName string, scriptFromConfig string, options *ExecOptions) error {
 	var sb strings.Builder
 	sb.WriteString(`
 		#!/bin/bash
@@ -79,9 +120,66 @@ func executeScript(actionName string, scriptFromConfig string, logger *slog.Logg
 	sb.WriteString(scriptFromConfig)
 	script := sb.String()
 
-	logger.Info("executing action", "action", actionName, "project", projectName)
-	if err := utils.ExecScript(script, env, repoPath); err != nil {
-		return fmt.Errorf("failed executing [%v] action script: %v", actionName, err)
+	if _, err := os.Stat(utils.PathWithUserHome(options.repoPath)); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed executing [%v] action: repository [%v] not found at [%v], run \"titan clone\" to clone it", actionName, options.projectName, options.repoPath)
+	}
+
+	// Dump the script output to a file if requested. Keep stdout clean when a structured output is requested
+	var output io.Writer
+	if options.structured {
+		output = os.Stderr
+	}
+	if options.logPath != "" {
+		if err := os.MkdirAll(filepath.Dir(options.logPath), 0755); err != nil {
+			return fmt.Errorf("failed creating [%v] action log folder: %w", actionName, err)
+		}
+		logFile, err := os.Create(options.logPath)
+		if err != nil {
+			return fmt.Errorf("failed creating [%v] action log file: %w", actionName, err)
+		}
+		defer logFile.Close()
+		output = logFile
+	}
+
+	options.logger.Info("executing action", "action", actionName, "project", options.projectName)
+	if err := utils.ExecScript(script, options.env, options.repoPath, output); err != nil {
+		return fmt.Errorf("failed executing [%v] action script: %w", actionName, err)
+	}
+	return nil
+}
+
+// cacheKey returns the key the hash of the last successful run of the action on the repository is stored with
+func cacheKey(repository string, actionName string) string {
+	return fmt.Sprintf("%v-%v", repository, actionName)
+}
+
+// executeCachedScript executes the script unless the action has a cache configured and its inputs did
+// not change since the last successful run
+func executeCachedScript(actionName string, scriptFromConfig string, options *ExecOptions) error {
+	if options.repoAction == nil || options.repoAction.Cache == nil {
+		return executeScript(actionName, scriptFromConfig, options)
+	}
+
+	store := cache.NewStore(options.cacheDir)
+	key := cacheKey(options.name, actionName)
+	hash, err := cache.Hash(options.repoPath, options.env, options.repoAction.Cache, scriptFromConfig)
+	if err != nil {
+		return fmt.Errorf("failed computing [%v] action cache hash: %w", actionName, err)
+	}
+	if !options.force && store.Matches(key, hash) {
+		options.logger.Info("skipping action, inputs did not change", "action", actionName, "project", options.projectName)
+		options.skipped = true
+		return nil
+	}
+
+	if err := executeScript(actionName, scriptFromConfig, options); err != nil {
+		if err := store.Delete(key); err != nil {
+			options.logger.Warn("failed removing action cache", "action", actionName, "project", options.projectName, "error", err)
+		}
+		return err
+	}
+	if err := store.Save(key, hash); err != nil {
+		options.logger.Warn("failed saving action cache", "action", actionName, "project", options.projectName, "error", err)
 	}
 	return nil
 }
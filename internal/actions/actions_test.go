@@ -0,0 +1,85 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+func TestRepositoriesSharingAFolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repo1")
+	gitCommand(t, "", "clone", newRemote(t), path)
+	if err := os.WriteFile(filepath.Join(path, "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	install := &types.RepoAction{
+		Cache:    &types.RepoActionCache{Files: []string{"package.json"}},
+		Commands: []types.RepoCommands{{Value: "echo $TITAN_REPOSITORY >> installed"}},
+	}
+
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	report := NewReport()
+	for _, name := range []string{"app1", "app2", "app1"} {
+		options := newTestOptions(t, utils.INSTALL, name, types.Repository{Path: path}, install)
+		options.cacheDir, options.report = cacheDir, report
+		options.env = append(options.env, "TITAN_REPOSITORY="+name)
+		if err := NewInstallAction().Execute(options); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewStatusAction().Execute(options); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second install of app1 is skipped, as its inputs did not change
+	if got := strings.Fields(readFile(t, filepath.Join(path, "installed"))); strings.Join(got, ",") != "app1,app2" {
+		t.Errorf("installed %v", got)
+	}
+	var reported []string
+	for _, entry := range report.Entries() {
+		reported = append(reported, entry.Repository)
+	}
+	if got := strings.Join(reported, ","); got != "app1,app1,app2" {
+		t.Errorf("reported %v", got)
+	}
+}
+
+func TestCleanRunsTheCachedActionsAgain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repo1")
+	gitCommand(t, "", "clone", newRemote(t), path)
+	// The builds are counted outside of the repository, so they do not change the hashed inputs
+	builds := filepath.Join(t.TempDir(), "builds")
+	build := &types.RepoAction{
+		Cache:    &types.RepoActionCache{Git: true, Lockfile: true},
+		Commands: []types.RepoCommands{{Value: "mkdir -p dist && echo built >> " + builds}},
+	}
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	run := func(action Action, repoAction *types.RepoAction) {
+		t.Helper()
+		options := newTestOptions(t, utils.REPO_ALL, "app1", types.Repository{Path: path}, repoAction)
+		options.cacheDir = cacheDir
+		if err := action.Execute(options); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(NewBuildAction(), build)
+	// Cached, the inputs did not change
+	run(NewBuildAction(), build)
+	// The default script removes the dist folders
+	run(NewCleanAction(), nil)
+	if _, err := os.Stat(filepath.Join(path, "dist")); err == nil {
+		t.Fatal("dist not removed by clean")
+	}
+	run(NewBuildAction(), build)
+
+	if got := strings.Fields(readFile(t, builds)); len(got) != 2 {
+		t.Errorf("built %d times, want 2", len(got))
+	}
+	if _, err := os.Stat(filepath.Join(path, "dist")); err != nil {
+		t.Errorf("dist not built again: %v", err)
+	}
+}
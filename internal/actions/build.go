@@ -30,5 +30,5 @@ func (ba BuildAction) Execute(options *ExecOptions) error {
 	defaultScript := "pnpm run build:local"
 	scriptFromConfig := getScriptFromConfig(ba.name, options.repoAction, nil, defaultScript, options.logger)
 
-	return executeScript(ba.name, scriptFromConfig, options.logger, options.repoPath, options.projectName, options.env)
+	return executeCachedScript(ba.name, scriptFromConfig, options)
 }
@@ -0,0 +1,83 @@
+package actions
+
+import (
+	"fmt"
+	"slices"
+	"titan/internal/git"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// CheckoutAction switches a repository to the requested branch
+type CheckoutAction struct {
+	name     string
+	commands []types.Action
+}
+
+func NewCheckoutAction() CheckoutAction {
+	return CheckoutAction{
+		name:     "checkout",
+		commands: []types.Action{utils.CHECKOUT},
+	}
+}
+
+func (ca CheckoutAction) Name() string {
+	return ca.name
+}
+
+func (ca CheckoutAction) ShouldExecute(command types.Action) bool {
+	return slices.Contains(ca.commands, command)
+}
+
+func (ca CheckoutAction) Execute(options *ExecOptions) error {
+	status, err := git.GetStatus(options.repoPath, options.env)
+	if err != nil {
+		options.report.Add(options.name, nil, "status failed")
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", ca.name, options.projectName, err)
+	}
+	if status.Branch == options.branch {
+		options.report.Add(options.name, status, "already on branch")
+		return nil
+	}
+	if status.Dirty {
+		options.report.Add(options.name, status, "dirty working tree, checkout skipped")
+		return fmt.Errorf("refusing to checkout [%v] on [%v]: working tree has local changes", options.branch, options.projectName)
+	}
+
+	branch := options.branch
+	create := false
+	note := "switched"
+	if !git.HasBranch(options.repoPath, options.env, branch) {
+		if options.createBranch {
+			create = true
+			note = "created"
+		} else {
+			// Fall back to the configured branch, or the remote default one, when the branch is absent
+			branch = options.repository.Branch
+			if branch == "" {
+				branch, err = git.DefaultBranch(options.repoPath, options.env)
+				if err != nil {
+					options.report.Add(options.name, status, "branch not found")
+					return fmt.Errorf("failed executing [%v] action on [%v]: %w", ca.name, options.projectName, err)
+				}
+			}
+			note = fmt.Sprintf("branch not found, using %v", branch)
+		}
+	}
+
+	if branch != status.Branch {
+		options.logger.Info("executing action", "action", ca.name, "project", options.projectName, "branch", branch)
+		if err := git.Checkout(options.repoPath, options.env, branch, create); err != nil {
+			options.report.Add(options.name, status, "checkout failed")
+			return fmt.Errorf("failed executing [%v] action on [%v]: %w", ca.name, options.projectName, err)
+		}
+	}
+
+	updated, err := git.GetStatus(options.repoPath, options.env)
+	if err != nil {
+		options.report.Add(options.name, nil, "status failed")
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", ca.name, options.projectName, err)
+	}
+	options.report.Add(options.name, updated, note)
+	return nil
+}
@@ -1,7 +1,9 @@
 package actions
 
 import (
+	"fmt"
 	"slices"
+	"titan/internal/cache"
 	"titan/internal/utils"
 	"titan/pkg/types"
 )
@@ -37,5 +39,15 @@ func (ca CleanAction) Execute(options *ExecOptions) error {
 	}
 	scriptFromConfig := getScriptFromConfig(ca.name, options.repoAction, ctx, defaultScript, options.logger)
 
-	return executeScript(ca.name, scriptFromConfig, options.logger, options.repoPath, options.projectName, options.env)
+	if err := executeScript(ca.name, scriptFromConfig, options); err != nil {
+		return err
+	}
+	// The outputs of the cached actions are gone, so they have to run again even if their inputs did not change
+	store := cache.NewStore(options.cacheDir)
+	for _, action := range []string{NewInstallAction().Name(), NewBuildAction().Name()} {
+		if err := store.Delete(cacheKey(options.name, action)); err != nil {
+			return fmt.Errorf("failed executing [%v] action: removing the [%v] action cache: %w", ca.name, action, err)
+		}
+	}
+	return nil
 }
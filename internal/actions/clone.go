@@ -0,0 +1,59 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"titan/internal/git"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// CloneAction clones the repositories missing on disk from their configured remote
+type CloneAction struct {
+	name     string
+	commands []types.Action
+}
+
+func NewCloneAction() CloneAction {
+	return CloneAction{
+		name:     "clone",
+		commands: []types.Action{utils.CLONE, utils.BOOTSTRAP},
+	}
+}
+
+func (ca CloneAction) Name() string {
+	return ca.name
+}
+
+func (ca CloneAction) ShouldExecute(command types.Action) bool {
+	return slices.Contains(ca.commands, command)
+}
+
+func (ca CloneAction) Execute(options *ExecOptions) error {
+	path := utils.PathWithUserHome(options.repoPath)
+	if _, err := os.Stat(path); err == nil {
+		options.logger.Debug("repository already present, skipping clone", "project", options.projectName, "path", path)
+		options.skipped = true
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", ca.name, options.projectName, err)
+	}
+
+	if options.repository.Remote == "" {
+		return fmt.Errorf("failed executing [%v] action: repository [%v] is missing and has no remote configured", ca.name, options.projectName)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", ca.name, options.projectName, err)
+	}
+
+	options.logger.Info("executing action", "action", ca.name, "project", options.projectName, "remote", options.repository.Remote)
+	if err := git.Clone(options.repository.Remote, options.repository.Branch, path, options.env); err != nil {
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", ca.name, options.projectName, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package actions
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"titan/internal/core"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// gitEnv identifies the commits made by the tests, whatever the git configuration of the machine
+var gitEnv = append(os.Environ(),
+	"GIT_AUTHOR_NAME=titan", "GIT_AUTHOR_EMAIL=titan@localhost",
+	"GIT_COMMITTER_NAME=titan", "GIT_COMMITTER_EMAIL=titan@localhost",
+	"GIT_CONFIG_GLOBAL=/dev/null",
+)
+
+func gitCommand(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newRemote returns a bare repository with a commit on main and another one on the given branches
+func newRemote(t *testing.T, branches ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.git")
+	work := filepath.Join(dir, "work")
+	gitCommand(t, dir, "init", "--bare", "--initial-branch=main", remote)
+	gitCommand(t, dir, "init", "--initial-branch=main", work)
+	if err := os.WriteFile(filepath.Join(work, "README.md"), []byte("main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCommand(t, work, "add", ".")
+	gitCommand(t, work, "commit", "-m", "main")
+	for _, branch := range branches {
+		gitCommand(t, work, "checkout", "-b", branch, "main")
+		if err := os.WriteFile(filepath.Join(work, "README.md"), []byte(branch+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitCommand(t, work, "commit", "-am", branch)
+	}
+	gitCommand(t, work, "push", remote, "--all")
+	return remote
+}
+
+func newTestOptions(t *testing.T, action types.Action, name string, repository types.Repository, repoAction *types.RepoAction) *ExecOptions {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewExecOptions(logger, gitEnv, repoAction, repository, name, filepath.Base(repository.Path), "", core.Command{Action: action, Output: "text"},
+		filepath.Join(t.TempDir(), "cache"), "", NewReport())
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestClone(t *testing.T) {
+	remote := newRemote(t, "develop")
+
+	t.Run("clones the default branch", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nested", "repo")
+		options := newTestOptions(t, utils.CLONE, "repo", types.Repository{Path: path, Remote: remote}, nil)
+		if err := NewCloneAction().Execute(options); err != nil {
+			t.Fatal(err)
+		}
+		if got := gitCommand(t, path, "rev-parse", "--abbrev-ref", "HEAD"); got != "main" {
+			t.Errorf("cloned branch %q", got)
+		}
+	})
+
+	t.Run("clones the configured branch", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "repo")
+		options := newTestOptions(t, utils.CLONE, "repo", types.Repository{Path: path, Remote: remote, Branch: "develop"}, nil)
+		if err := NewCloneAction().Execute(options); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, filepath.Join(path, "README.md")); got != "develop\n" {
+			t.Errorf("cloned content %q", got)
+		}
+	})
+
+	t.Run("skips repositories present", func(t *testing.T) {
+		path := t.TempDir()
+		options := newTestOptions(t, utils.CLONE, "repo", types.Repository{Path: path, Remote: remote}, nil)
+		if err := NewCloneAction().Execute(options); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			t.Error("cloned into a present repository")
+		}
+	})
+
+	t.Run("fails without remote", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "repo")
+		options := newTestOptions(t, utils.CLONE, "repo", types.Repository{Path: path}, nil)
+		err := NewCloneAction().Execute(options)
+		if err == nil || !strings.Contains(err.Error(), "no remote configured") {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+
+	t.Run("fails with a missing branch", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "repo")
+		options := newTestOptions(t, utils.CLONE, "repo", types.Repository{Path: path, Remote: remote, Branch: "missing"}, nil)
+		err := NewCloneAction().Execute(options)
+		// The exit code of git is kept, so it is recorded on the history
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 128 {
+			t.Fatalf("expected git to exit with 128, got %v", err)
+		}
+	})
+}
+
+func TestBootstrap(t *testing.T) {
+	remote := newRemote(t)
+	path := filepath.Join(t.TempDir(), "repo")
+	// The install leaves a file behind to check it ran on the cloned repository
+	install := &types.RepoAction{Commands: []types.RepoCommands{{Value: "pwd > installed"}}}
+
+	var executed []string
+	for _, action := range []Action{NewCloneAction(), NewFetchAction(), NewCleanAction(), NewInstallAction(), NewBuildAction(), NewStatusAction(), NewCheckoutAction()} {
+		if !action.ShouldExecute(utils.BOOTSTRAP) {
+			continue
+		}
+		executed = append(executed, action.Name())
+		options := newTestOptions(t, utils.BOOTSTRAP, "repo", types.Repository{Path: path, Remote: remote}, install)
+		if err := action.Execute(options); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(executed, ","); got != "clone,install" {
+		t.Errorf("executed %v", got)
+	}
+	if got := strings.TrimSpace(readFile(t, filepath.Join(path, "installed"))); got != path {
+		t.Errorf("installed on %q", got)
+	}
+}
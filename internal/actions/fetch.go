@@ -1,11 +1,16 @@
 package actions
 
 import (
+	"fmt"
 	"slices"
+	"titan/internal/git"
 	"titan/internal/utils"
 	"titan/pkg/types"
 )
 
+// gitMode is the fetch mode that uses the built-in git implementation instead of a script
+const gitMode = "git"
+
 // Fetch action
 type FetchAction struct {
 	name     string
@@ -28,11 +33,59 @@ func (fa FetchAction) ShouldExecute(command types.Action) bool {
 }
 
 func (fa FetchAction) Execute(options *ExecOptions) error {
+	if options.repoAction != nil && options.repoAction.Mode == gitMode {
+		return fa.executeGit(options)
+	}
+
 	defaultScript := `
 		git fetch -p && git pull
 		git fetch --tags --force && git fetch --prune --prune-tags
 	`
 	scriptFromConfig := getScriptFromConfig(fa.name, options.repoAction, nil, defaultScript, options.logger)
 
-	return executeScript(fa.name, scriptFromConfig, options.logger, options.repoPath, options.projectName, options.env)
+	return executeScript(fa.name, scriptFromConfig, options)
+}
+
+// executeGit fetches the repository and fast-forwards the current branch, recording the
+// resulting status in the report
+func (fa FetchAction) executeGit(options *ExecOptions) error {
+	options.logger.Info("executing action", "action", fa.name, "project", options.projectName, "mode", gitMode)
+
+	if err := git.Fetch(options.repoPath, options.env); err != nil {
+		options.report.Add(options.name, nil, "fetch failed")
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", fa.name, options.projectName, err)
+	}
+
+	status, err := git.GetStatus(options.repoPath, options.env)
+	if err != nil {
+		options.report.Add(options.name, nil, "status failed")
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", fa.name, options.projectName, err)
+	}
+
+	if status.Upstream == "" || status.Behind == 0 {
+		options.report.Add(options.name, status, "")
+		return nil
+	}
+	if status.Ahead > 0 {
+		options.report.Add(options.name, status, "diverged from upstream, pull skipped")
+		return fmt.Errorf("refusing to pull [%v]: branch [%v] has diverged from [%v]", options.projectName, status.Branch, status.Upstream)
+	}
+	if status.Dirty && !options.autoStash {
+		options.report.Add(options.name, status, "dirty working tree, pull skipped")
+		return fmt.Errorf("refusing to pull [%v]: working tree has local changes, use --autostash to pull anyway", options.projectName)
+	}
+
+	if err := git.FastForward(options.repoPath, options.env, options.autoStash); err != nil {
+		options.report.Add(options.name, status, "fast-forward failed")
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", fa.name, options.projectName, err)
+	}
+
+	updated, err := git.GetStatus(options.repoPath, options.env)
+	if err != nil {
+		options.report.Add(options.name, nil, "status failed")
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", fa.name, options.projectName, err)
+	}
+	updated.FastForwarded = true
+	options.report.Add(options.name, updated, "")
+	return nil
 }
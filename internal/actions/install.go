@@ -14,7 +14,7 @@ type InstallAction struct {
 func NewInstallAction() InstallAction {
 	return InstallAction{
 		name:     "install",
-		commands: []types.Action{utils.REPO_ALL, utils.INSTALL},
+		commands: []types.Action{utils.REPO_ALL, utils.INSTALL, utils.BOOTSTRAP},
 	}
 }
 
@@ -30,5 +30,5 @@ func (ia InstallAction) Execute(options *ExecOptions) error {
 	defaultScript := "pnpm install --frozen-lockfile --prefer-offline"
 	scriptFromConfig := getScriptFromConfig(ia.name, options.repoAction, nil, defaultScript, options.logger)
 
-	return executeScript(ia.name, scriptFromConfig, options.logger, options.repoPath, options.projectName, options.env)
+	return executeCachedScript(ia.name, scriptFromConfig, options)
 }
@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"titan/internal/events"
+	"titan/internal/git"
+)
+
+// ReportEntry holds the git status of a single repository
+type ReportEntry struct {
+	Repository string
+	Status     *git.Status
+	Note       string
+}
+
+// Report collects the git status of the repositories processed by the actions so it
+// can be printed as a single table once all of them are done
+type Report struct {
+	mu      sync.Mutex
+	entries []ReportEntry
+}
+
+// NewReport returns an empty Report
+func NewReport() *Report {
+	return &Report{}
+}
+
+// Add records the status of a repository. It is safe to call from several goroutines
+func (r *Report) Add(repository string, status *git.Status, note string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, ReportEntry{Repository: repository, Status: status, Note: note})
+}
+
+// Entries returns the recorded entries sorted by repository name
+func (r *Report) Entries() []ReportEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]ReportEntry, len(r.entries))
+	copy(entries, r.entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Repository < entries[j].Repository
+	})
+	return entries
+}
+
+// Print writes the recorded entries as a table to stdout
+func (r *Report) Print() {
+	entries := r.Entries()
+	if len(entries) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tBRANCH\tUPSTREAM\tAHEAD\tBEHIND\tDIRTY\tSTASHES\tUPDATED\tNOTE")
+	for _, entry := range entries {
+		s := entry.Status
+		if s == nil {
+			fmt.Fprintf(tw, "%v\t-\t-\t-\t-\t-\t-\t-\t%v\n", entry.Repository, entry.Note)
+			continue
+		}
+		upstream := s.Upstream
+		if upstream == "" {
+			upstream = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%d\t%d\t%v\t%d\t%v\t%v\n",
+			entry.Repository, s.Branch, upstream, s.Ahead, s.Behind, yesNo(s.Dirty), s.Stashes, yesNo(s.FastForwarded), entry.Note)
+	}
+	tw.Flush()
+}
+
+// Emit emits a repository status event for each recorded entry
+func (r *Report) Emit(emitter *events.Emitter) {
+	for _, entry := range r.Entries() {
+		event := events.Event{
+			Type:       events.REPOSITORY_STATUS,
+			Repository: entry.Repository,
+			State:      entry.Note,
+		}
+		if entry.Status != nil {
+			event.Data = entry.Status
+		}
+		emitter.Emit(event)
+	}
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"fmt"
+	"slices"
+	"titan/internal/git"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// StatusAction reports the git status of a repository without fetching from the remotes
+type StatusAction struct {
+	name     string
+	commands []types.Action
+}
+
+func NewStatusAction() StatusAction {
+	return StatusAction{
+		name:     "status",
+		commands: []types.Action{utils.STATUS},
+	}
+}
+
+func (sa StatusAction) Name() string {
+	return sa.name
+}
+
+func (sa StatusAction) ShouldExecute(command types.Action) bool {
+	return slices.Contains(sa.commands, command)
+}
+
+func (sa StatusAction) Execute(options *ExecOptions) error {
+	status, err := git.GetStatus(options.repoPath, options.env)
+	if err != nil {
+		options.report.Add(options.name, nil, "status failed")
+		return fmt.Errorf("failed executing [%v] action on [%v]: %w", sa.name, options.projectName, err)
+	}
+	options.report.Add(options.name, status, "")
+	return nil
+}
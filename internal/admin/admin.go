@@ -0,0 +1,198 @@
+package admin
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"titan/internal/core"
+	"titan/internal/events"
+	"titan/internal/proxy"
+	"titan/internal/tasks"
+	"titan/pkg/config"
+	"titan/pkg/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultLogLines is how many task log lines are returned when not requested otherwise
+const defaultLogLines = 100
+
+// maxFaultsBody is the maximum size of the faults set while running
+const maxFaultsBody = 1 << 20
+
+//go:embed dashboard.html
+var dashboard []byte
+
+// Server exposes the state of serve as a JSON API, plus a dashboard using it
+type Server struct {
+	proxy *proxy.Proxy
+	tasks *tasks.Manager
+}
+
+// NewServer returns a Server for the proxy and tasks
+func NewServer(proxy *proxy.Proxy, tasks *tasks.Manager) *Server {
+	return &Server{proxy: proxy, tasks: tasks}
+}
+
+// Handler returns the handler of the admin endpoints. Requests changing the state from other origins are
+// rejected, so the pages open on the browser cannot stop tasks or inject faults
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboard)
+	})
+	mux.HandleFunc("GET /api/routes", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.proxy.Routes())
+	})
+	mux.HandleFunc("GET /api/routes/{name}/faults", func(w http.ResponseWriter, r *http.Request) {
+		faults, overridden, err := s.proxy.Faults(r.PathValue("name"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeFaults(w, faults, overridden)
+	})
+	mux.HandleFunc("PUT /api/routes/{name}/faults", func(w http.ResponseWriter, r *http.Request) {
+		faults, err := readFaults(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.proxy.SetFaults(r.PathValue("name"), faults); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeFaults(w, faults, true)
+	})
+	mux.HandleFunc("DELETE /api/routes/{name}/faults", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.proxy.ResetFaults(r.PathValue("name")); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /api/metrics", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.proxy.Metrics().Snapshot())
+	})
+	mux.HandleFunc("GET /api/tasks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.tasks.States())
+	})
+	mux.HandleFunc("GET /api/tasks/{name}/logs", func(w http.ResponseWriter, r *http.Request) {
+		lines := defaultLogLines
+		if value := r.URL.Query().Get("lines"); value != "" {
+			var err error
+			if lines, err = strconv.Atoi(value); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lines %q", value))
+				return
+			}
+		}
+		logs, err := s.tasks.Logs(r.PathValue("name"), lines)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, logs)
+	})
+	mux.HandleFunc("POST /api/tasks/{name}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var err error
+		switch r.PathValue("action") {
+		case "start":
+			err = s.tasks.Start(name)
+		case "stop":
+			err = s.tasks.Stop(name)
+		case "restart":
+			err = s.tasks.Restart(name)
+		default:
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown task action %q", r.PathValue("action")))
+			return
+		}
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return http.NewCrossOriginProtection().Handler(mux)
+}
+
+// Start starts the admin server when configured. Errors from the running server are sent to the error channel
+func Start(errorChannel chan error, container *core.Container, server *Server) {
+	config := container.ConfigData.Config.Server.Admin
+	if config.Port == 0 {
+		return
+	}
+	host := config.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	go func() {
+		addr := fmt.Sprintf("%s:%d", host, config.Port)
+		container.Logger.Info("starting admin server", "address", addr)
+		container.Events.Emit(events.Event{Type: events.SERVER_STARTED, State: "admin", Data: addr})
+		httpServer := &http.Server{
+			Addr:     addr,
+			Handler:  server.Handler(),
+			ErrorLog: slog.NewLogLogger(container.Logger.Handler(), slog.LevelError),
+		}
+		if err := httpServer.ListenAndServe(); err != nil {
+			errorChannel <- err
+		}
+	}()
+}
+
+// readFaults reads the faults of the request body, written as in the configuration file, either as YAML or JSON
+func readFaults(r *http.Request) ([]types.Fault, error) {
+	var faults []types.Fault
+	decoder := yaml.NewDecoder(io.LimitReader(r.Body, maxFaultsBody))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&faults); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid faults: %w", err)
+	}
+	var issues []error
+	for i, fault := range faults {
+		for _, issue := range config.ValidateFault(fault) {
+			issues = append(issues, fmt.Errorf("faults[%d]%w", i, issue))
+		}
+	}
+	return faults, errors.Join(issues...)
+}
+
+// writeFaults sends the faults with the keys and durations of the configuration file
+func writeFaults(w http.ResponseWriter, faults []types.Fault, overridden bool) {
+	encoded, err := yaml.Marshal(faults)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	values := []any{}
+	if err := yaml.Unmarshal(encoded, &values); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"faults": values, "overridden": overridden})
+}
+
+func statusFor(err error) int {
+	if errors.Is(err, tasks.ErrTaskNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusConflict
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"titan/internal/core"
+	"titan/internal/events"
+	"titan/internal/tasks"
+)
+
+func TestCrossOriginRequestsAreRejected(t *testing.T) {
+	container := &core.Container{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Events: events.NewEmitter(events.TEXT, io.Discard),
+	}
+	handler := NewServer(nil, tasks.NewManager(make(chan error), container)).Handler()
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"without browser headers", http.MethodPost, nil, http.StatusNotFound},
+		{"from the dashboard", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusNotFound},
+		{"from the same origin", http.MethodPost, map[string]string{"Origin": "http://127.0.0.1:9000"}, http.StatusNotFound},
+		{"from another site", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"from another origin", http.MethodPost, map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"from an opaque origin", http.MethodPost, map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"reading from another site", http.MethodGet, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "/api/tasks/app:run/restart"
+			if test.method == http.MethodGet {
+				path = "/api/tasks/app:run/logs"
+			}
+			request := httptest.NewRequest(test.method, "http://127.0.0.1:9000"+path, nil)
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			// Not found means the request reached the tasks, which do not include the one requested
+			if recorder.Code != test.want {
+				t.Errorf("got status %d, want %d", recorder.Code, test.want)
+			}
+		})
+	}
+}
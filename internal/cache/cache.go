@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"titan/internal/git"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// lockfiles are the package manager lockfiles hashed when the lockfile input is enabled
+var lockfiles = []string{"pnpm-lock.yaml", "package-lock.json", "yarn.lock"}
+
+// skippedDirs are never walked when matching file patterns
+var skippedDirs = []string{".git", ".titan", "node_modules"}
+
+// toolchainEnv are the environment variables hashed along the script, as they select the Node version and how it
+// runs. The rest of the environment changes between shells, so it is left out
+var toolchainEnv = []string{"PATH", "NVM_BIN", "NODE_ENV", "NODE_OPTIONS"}
+
+// Hash computes a hash of the script and the configured inputs of the repository in dir
+func Hash(dir string, env []string, inputs *types.RepoActionCache, script string) (string, error) {
+	dir = utils.PathWithUserHome(dir)
+	h := sha256.New()
+	fmt.Fprintf(h, "script:%s\n", script)
+	for _, name := range toolchainEnv {
+		fmt.Fprintf(h, "env:%s=%s\n", name, lookupEnv(env, name))
+	}
+
+	if inputs.Git {
+		head, err := git.Head(dir, env)
+		if err != nil {
+			return "", err
+		}
+		diff, err := git.Diff(dir, env)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "head:%s\ndiff:%s\n", head, diff)
+		untracked, err := git.UntrackedFiles(dir, env)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range untracked {
+			if err := hashFile(h, dir, file); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if inputs.Lockfile {
+		for _, lockfile := range lockfiles {
+			if err := hashFile(h, dir, lockfile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+
+	if len(inputs.Files) > 0 {
+		files, err := matchFiles(dir, inputs.Files)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			if err := hashFile(h, dir, file); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookupEnv returns the last value of the variable in env, the process one when env is empty as the commands
+// inherit it then
+func lookupEnv(env []string, name string) string {
+	if len(env) == 0 {
+		return os.Getenv(name)
+	}
+	value := ""
+	for _, entry := range env {
+		if key, v, found := strings.Cut(entry, "="); found && key == name {
+			value = v
+		}
+	}
+	return value
+}
+
+// hashFile writes the relative name and contents of the file into the hash
+func hashFile(h hash.Hash, dir string, name string) error {
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fmt.Fprintf(h, "file:%s\n", filepath.ToSlash(name))
+	_, err = io.Copy(h, file)
+	return err
+}
+
+// matchFiles returns, sorted, the files in dir matching any of the patterns. Patterns use "/" as separator
+// and support "**" to match any number of directories
+func matchFiles(dir string, patterns []string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			for _, skipped := range skippedDirs {
+				if d.Name() == skipped {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range patterns {
+			if matchGlob(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// matchGlob matches the path segments against the pattern segments, where "**" matches zero or more segments
+func matchGlob(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], segments[1:])
+}
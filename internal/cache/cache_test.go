@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+	"titan/pkg/types"
+)
+
+func TestHashIncludesTheToolchain(t *testing.T) {
+	dir := t.TempDir()
+	inputs := &types.RepoActionCache{}
+	hash := func(env ...string) string {
+		t.Helper()
+		value, err := Hash(dir, env, inputs, "pnpm run build")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	node20 := hash("PATH=/nvm/v20/bin:/usr/bin", "SHLVL=1")
+	if got := hash("PATH=/nvm/v20/bin:/usr/bin", "SHLVL=2"); got != node20 {
+		t.Error("hash changed with a variable not related to the toolchain")
+	}
+	if got := hash("PATH=/nvm/v22/bin:/usr/bin", "SHLVL=1"); got == node20 {
+		t.Error("hash did not change with the Node version")
+	}
+	if got := hash("PATH=/nvm/v20/bin:/usr/bin", "NODE_ENV=production"); got == node20 {
+		t.Error("hash did not change with NODE_ENV")
+	}
+}
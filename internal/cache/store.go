@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store persists the hash of the last successful run of each repository action
+type Store struct {
+	dir string
+}
+
+// NewStore returns a Store keeping its state in the given directory
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key+".sha256")
+}
+
+// Matches checks if the hash is the same one stored for the key
+func (s *Store) Matches(key string, hash string) bool {
+	stored, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(stored)) == hash
+}
+
+// Save stores the hash for the key
+func (s *Store) Save(key string, hash string) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(key), []byte(hash+"\n"), 0644)
+}
+
+// Delete removes the hash stored for the key, if any
+func (s *Store) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
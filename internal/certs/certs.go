@@ -0,0 +1,268 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// caValidity is how long the local CA is valid for
+	caValidity = 10 * 365 * 24 * time.Hour
+	// leafValidity is how long the issued certificates are valid for. Browsers reject longer ones
+	leafValidity = 397 * 24 * time.Hour
+	// renewBefore is how long before expiring the issued certificate is rotated
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// Dir returns the folder where the local CA and the issued certificates are kept, within titan state folder
+func Dir(stateDir string) string {
+	return filepath.Join(stateDir, "certs")
+}
+
+// Authority is a local development CA issuing the certificates of the proxy. Its files are kept in a folder
+// so the same CA is reused, and only has to be trusted once
+type Authority struct {
+	dir string
+
+	mu   sync.Mutex
+	leaf *tls.Certificate
+}
+
+// NewAuthority returns an Authority keeping its files in the given folder
+func NewAuthority(dir string) *Authority {
+	return &Authority{dir: dir}
+}
+
+// CAPath returns the path of the CA certificate, the one to trust
+func (a *Authority) CAPath() string {
+	return filepath.Join(a.dir, "ca.crt")
+}
+
+func (a *Authority) caKeyPath() string {
+	return filepath.Join(a.dir, "ca.key")
+}
+
+// CertPath returns the path of the issued certificate
+func (a *Authority) CertPath() string {
+	return filepath.Join(a.dir, "server.crt")
+}
+
+// KeyPath returns the path of the issued certificate private key
+func (a *Authority) KeyPath() string {
+	return filepath.Join(a.dir, "server.key")
+}
+
+// Ensure creates the CA if missing and issues a certificate for the hosts unless the current one covers
+// all of them and is not about to expire. With renew set the certificate is issued regardless
+func (a *Authority) Ensure(hosts []string, renew bool) (*x509.Certificate, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	caCert, caKey, err := a.loadOrCreateCA()
+	if err != nil {
+		return nil, err
+	}
+
+	if !renew {
+		if leaf, err := a.loadLeaf(); err == nil && isValidFor(leaf.Leaf, caCert, hosts) {
+			a.leaf = leaf
+			return leaf.Leaf, nil
+		}
+	}
+
+	leaf, err := a.issue(caCert, caKey, hosts)
+	if err != nil {
+		return nil, err
+	}
+	a.leaf = leaf
+	return leaf.Leaf, nil
+}
+
+// GetCertificate returns a function for tls.Config that serves the issued certificate, rotating it when
+// it is about to expire
+func (a *Authority) GetCertificate(hosts []string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		a.mu.Lock()
+		leaf := a.leaf
+		a.mu.Unlock()
+		if leaf != nil && time.Until(leaf.Leaf.NotAfter) > renewBefore {
+			return leaf, nil
+		}
+		if _, err := a.Ensure(hosts, false); err != nil {
+			return nil, err
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.leaf, nil
+	}
+}
+
+func (a *Authority) loadOrCreateCA() (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(a.CAPath(), a.caKeyPath())
+	if err == nil && time.Until(pair.Leaf.NotAfter) > renewBefore {
+		return pair.Leaf, pair.PrivateKey.(crypto.Signer), nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed loading local CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed generating local CA key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"titan local development CA"},
+			CommonName:   strings.TrimSpace("titan " + hostname),
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed creating local CA: %w", err)
+	}
+	if err := writePair(a.CAPath(), a.caKeyPath(), der, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func (a *Authority) loadLeaf() (*tls.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(a.CertPath(), a.KeyPath())
+	if err != nil {
+		return nil, err
+	}
+	return &pair, nil
+}
+
+func (a *Authority) issue(caCert *x509.Certificate, caKey crypto.Signer, hosts []string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating certificate key: %w", err)
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"titan local development certificate"},
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(leafValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(hosts) > 0 {
+		template.Subject.CommonName = hosts[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed issuing certificate: %w", err)
+	}
+	if err := writePair(a.CertPath(), a.KeyPath(), der, key); err != nil {
+		return nil, err
+	}
+	leaf, err := a.loadLeaf()
+	if err != nil {
+		return nil, fmt.Errorf("failed loading issued certificate: %w", err)
+	}
+	return leaf, nil
+}
+
+// isValidFor checks the certificate is signed by the CA, covers all the hosts and is not about to expire
+func isValidFor(cert *x509.Certificate, caCert *x509.Certificate, hosts []string) bool {
+	if cert == nil || time.Until(cert.NotAfter) <= renewBefore {
+		return false
+	}
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+				return false
+			}
+		} else if !slices.Contains(cert.DNSNames, host) {
+			return false
+		}
+	}
+	return true
+}
+
+func writePair(certPath string, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return fmt.Errorf("failed creating certificates folder: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed encoding private key: %w", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed writing private key: %w", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed writing certificate: %w", err)
+	}
+	return nil
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed generating serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// Hosts returns the hosts the certificate of the server has to cover: its host plus the extra SANs
+func Hosts(host string, sans []string) []string {
+	var hosts []string
+	for _, h := range append([]string{host}, sans...) {
+		if h = strings.TrimSpace(h); h != "" && !slices.Contains(hosts, h) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
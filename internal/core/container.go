@@ -1,8 +1,12 @@
 package core
 
 import (
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"titan/internal/events"
+	"titan/internal/logging"
 	"titan/internal/utils"
 	"titan/pkg/config"
 	"titan/pkg/types"
@@ -14,6 +18,20 @@ type Command struct {
 	Action types.Action
 	// Profile is required for server proxy action
 	Profile string
+	// AutoStash allows pulling on repositories with local changes by stashing them first
+	AutoStash bool
+	// Jobs limits how many repositories are processed at the same time. 0 means no limit
+	Jobs int
+	// Only restricts the repository actions to the given repository names
+	Only []string
+	// Branch to switch the repositories to
+	Branch string
+	// Create creates the branch on the repositories where it does not exist
+	Create bool
+	// Force runs the actions even if their cached inputs did not change
+	Force bool
+	// Output is the format of the command output
+	Output events.Format
 }
 
 type Configuration struct {
@@ -25,6 +43,11 @@ type Configuration struct {
 	Profile types.Profile
 }
 
+// StateDir returns the directory where titan keeps its state, next to the config file
+func (c Configuration) StateDir() string {
+	return filepath.Join(filepath.Dir(c.ConfigFilePath), ".titan")
+}
+
 // Container holds data that can be used across the app
 type Container struct {
 	// Logger holds the logger instance to use across the app
@@ -35,13 +58,29 @@ type Container struct {
 	Command Command
 	// SharedEnvironment
 	SharedEnvironment []string
+	// Events emits the machine readable events of the command when a structured output is requested
+	Events *events.Emitter
 }
 
 type ContainerOptions struct {
-	Logger        *slog.Logger
+	// Logger is used until the configured logger is set up
+	Logger *slog.Logger
+	// Logging overrides the logging configuration from the config file
+	Logging       types.Logging
 	CommandAction types.Action
 	Profile       string
 	ConfigPath    string
+	AutoStash     bool
+	Jobs          int
+	Only          []string
+	Branch        string
+	Create        bool
+	Force         bool
+	Output        events.Format
+	// SkipEnvironment avoids setting up nvm and pnpm for commands that do not need them
+	SkipEnvironment bool
+	// LogOutput is where the logs are written to when no log file is configured. Defaults to stderr
+	LogOutput io.Writer
 }
 
 // NewContainer retuns a Container
@@ -52,27 +91,52 @@ func NewContainer(options ContainerOptions) *Container {
 		options.Logger.Error("failed retrieving configuration", "error", err)
 		os.Exit(1)
 	}
-	// Setup nvm and pnpm to use as environment on other shell executions
-	env, err := utils.CaptureEnvironment(config.Versions)
+	// Setup the logger as configured, flags taking precedence over the config file
+	handler, err := logging.NewHandler(logging.Merge(config.Logging, options.Logging), options.LogOutput)
 	if err != nil {
-		options.Logger.Error("failure setting up shared bash environment", "error", err)
+		options.Logger.Error("failed setting up logger", "error", err)
 		os.Exit(1)
 	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+
+	// Setup nvm and pnpm to use as environment on other shell executions
+	var env []string
+	if !options.SkipEnvironment {
+		env, err = utils.CaptureEnvironment(config.Versions)
+		if err != nil {
+			logger.Error("failure setting up shared bash environment", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	output := options.Output
+	if output == "" {
+		output = events.TEXT
+	}
 
 	// cleanUpFuncs = addCleanUpFunc(cleanUpFuncs, "sample cleanup name", func() error {
 	// 	return nil
 	// })
 
 	return &Container{
-		Logger: options.Logger,
+		Logger: logger,
 		Command: Command{
-			Action:  options.CommandAction,
-			Profile: options.Profile,
+			Action:    options.CommandAction,
+			Profile:   options.Profile,
+			AutoStash: options.AutoStash,
+			Jobs:      options.Jobs,
+			Only:      options.Only,
+			Branch:    options.Branch,
+			Create:    options.Create,
+			Force:     options.Force,
+			Output:    output,
 		},
 		ConfigData: Configuration{
 			ConfigFilePath: options.ConfigPath,
 			Config:         config,
 		},
 		SharedEnvironment: env,
+		Events:            events.NewEmitter(output, os.Stdout),
 	}
 }
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Format is the format of the output of titan commands
+type Format string
+
+const (
+	// TEXT is the human readable output, with tables and logs
+	TEXT Format = "text"
+	// JSON prints all the events as a single JSON array once the command finishes
+	JSON Format = "json"
+	// NDJSON streams each event as a JSON object on its own line
+	NDJSON Format = "ndjson"
+)
+
+// Event types
+const (
+	RUN_STARTED         = "run.started"
+	RUN_FINISHED        = "run.finished"
+	ACTION_STARTED      = "action.started"
+	ACTION_FINISHED     = "action.finished"
+	REPOSITORY_STATUS   = "repository.status"
+	VALIDATION_ISSUE    = "validation.issue"
+	VALIDATION_FINISHED = "validation.finished"
+	SERVER_STARTED      = "server.started"
+	SERVER_STOPPED      = "server.stopped"
+	TASK_STATE          = "task.state"
+	CONFIG_RELOADED     = "config.reloaded"
+)
+
+// ParseFormat returns the Format for the given value, defaulting to TEXT when empty
+func ParseFormat(value string) (Format, error) {
+	switch Format(value) {
+	case "", TEXT:
+		return TEXT, nil
+	case JSON, NDJSON:
+		return Format(value), nil
+	}
+	return "", fmt.Errorf("invalid output format %q, valid ones are text, json and ndjson", value)
+}
+
+// Event is a machine readable record of something that happened while running a command
+type Event struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Command    string    `json:"command,omitempty"`
+	Repository string    `json:"repository,omitempty"`
+	Action     string    `json:"action,omitempty"`
+	Task       string    `json:"task,omitempty"`
+	State      string    `json:"state,omitempty"`
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	DurationMs *int64    `json:"durationMs,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Data       any       `json:"data,omitempty"`
+}
+
+// WithExitCode sets the exit code of the event
+func (e Event) WithExitCode(exitCode int) Event {
+	e.ExitCode = &exitCode
+	return e
+}
+
+// WithDuration sets the duration of the event
+func (e Event) WithDuration(duration time.Duration) Event {
+	ms := duration.Milliseconds()
+	e.DurationMs = &ms
+	return e
+}
+
+// Emitter writes the events in the configured format
+type Emitter struct {
+	format Format
+	w      io.Writer
+
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewEmitter returns an Emitter writing the events in the given format to w
+func NewEmitter(format Format, w io.Writer) *Emitter {
+	return &Emitter{format: format, w: w}
+}
+
+// Structured checks if the events are written, meaning no other output should go to the writer
+func (e *Emitter) Structured() bool {
+	return e != nil && e.format != TEXT
+}
+
+// Emit records the event. It is safe to call from several goroutines
+func (e *Emitter) Emit(event Event) {
+	if !e.Structured() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch e.format {
+	case NDJSON:
+		line, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		e.w.Write(append(line, '\n'))
+	case JSON:
+		e.events = append(e.events, event)
+	}
+}
+
+// Flush writes the events collected so far when using the JSON format
+func (e *Emitter) Flush() error {
+	if e == nil || e.format != JSON {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	events := e.events
+	if events == nil {
+		events = []Event{}
+	}
+	encoder := json.NewEncoder(e.w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(events); err != nil {
+		return err
+	}
+	e.events = nil
+	return nil
+}
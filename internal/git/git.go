@@ -0,0 +1,168 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"titan/internal/utils"
+)
+
+// Status holds the state of a repository working tree compared against its upstream
+type Status struct {
+	// Branch currently checked out. "HEAD" when detached
+	Branch string `json:"branch"`
+	// Upstream tracking branch, empty if the branch does not track any
+	Upstream string `json:"upstream"`
+	// Ahead number of local commits not present in the upstream
+	Ahead int `json:"ahead"`
+	// Behind number of upstream commits not present locally
+	Behind int `json:"behind"`
+	// Dirty indicates the working tree has uncommitted changes
+	Dirty bool `json:"dirty"`
+	// Stashes number of entries in the stash
+	Stashes int `json:"stashes"`
+	// FastForwarded indicates the branch was fast-forwarded during this run
+	FastForwarded bool `json:"fastForwarded"`
+}
+
+// run executes a git command on the given directory and returns its trimmed output
+func run(dir string, env []string, args ...string) (string, error) {
+	options := utils.NewExecCommandOptions(env, dir, "git", args...)
+	output, err := utils.ExecCommandOutput(options)
+	if err != nil {
+		return "", fmt.Errorf("git %v: %w", strings.Join(args, " "), err)
+	}
+	return output, nil
+}
+
+// Fetch fetches branches and tags from the remotes, pruning the ones deleted upstream
+func Fetch(dir string, env []string) error {
+	_, err := run(dir, env, "fetch", "--prune", "--tags", "--force")
+	return err
+}
+
+// GetStatus returns the status of the repository without contacting the remotes
+func GetStatus(dir string, env []string) (*Status, error) {
+	status := &Status{}
+
+	branch, err := run(dir, env, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	status.Branch = branch
+
+	// A missing upstream is not an error, the branch simply does not track anything
+	if upstream, err := run(dir, env, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}"); err == nil {
+		status.Upstream = upstream
+	}
+
+	if status.Upstream != "" {
+		counts, err := run(dir, env, "rev-list", "--left-right", "--count", "HEAD...@{u}")
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(counts)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected rev-list output %q", counts)
+		}
+		status.Ahead, _ = strconv.Atoi(fields[0])
+		status.Behind, _ = strconv.Atoi(fields[1])
+	}
+
+	changes, err := run(dir, env, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	status.Dirty = changes != ""
+
+	stashes, err := run(dir, env, "stash", "list")
+	if err != nil {
+		return nil, err
+	}
+	if stashes != "" {
+		status.Stashes = len(strings.Split(stashes, "\n"))
+	}
+
+	return status, nil
+}
+
+// FastForward merges the upstream into the current branch only if it can be fast-forwarded.
+// When autoStash is set local changes are stashed before the merge and restored afterwards
+func FastForward(dir string, env []string, autoStash bool) error {
+	args := []string{"merge", "--ff-only"}
+	if autoStash {
+		args = append(args, "--autostash")
+	}
+	args = append(args, "@{u}")
+	_, err := run(dir, env, args...)
+	return err
+}
+
+// Clone clones the remote into the given path. When branch is empty the remote default branch is used
+func Clone(remote string, branch string, path string, env []string) error {
+	args := []string{"clone"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	args = append(args, remote, path)
+	_, err := run("", env, args...)
+	return err
+}
+
+// HasBranch checks if the branch exists locally or on the origin remote
+func HasBranch(dir string, env []string, branch string) bool {
+	for _, ref := range []string{"refs/heads/" + branch, "refs/remotes/origin/" + branch} {
+		if _, err := run(dir, env, "rev-parse", "--verify", "--quiet", ref); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultBranch returns the default branch of the origin remote, falling back to "main" or "master"
+// when the remote HEAD is unknown
+func DefaultBranch(dir string, env []string) (string, error) {
+	if ref, err := run(dir, env, "symbolic-ref", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimPrefix(ref, "origin/"), nil
+	}
+	for _, branch := range []string{"main", "master"} {
+		if HasBranch(dir, env, branch) {
+			return branch, nil
+		}
+	}
+	return "", fmt.Errorf("unable to determine the default branch")
+}
+
+// Checkout switches the working tree to the branch, creating it from the current HEAD when create is set.
+// Branches only present on origin are checked out tracking the remote one
+func Checkout(dir string, env []string, branch string, create bool) error {
+	args := []string{"checkout"}
+	if create {
+		args = append(args, "-b")
+	}
+	args = append(args, branch)
+	_, err := run(dir, env, args...)
+	return err
+}
+
+// Head returns the commit hash HEAD points to
+func Head(dir string, env []string) (string, error) {
+	return run(dir, env, "rev-parse", "HEAD")
+}
+
+// Diff returns the uncommitted changes of tracked files compared to HEAD
+func Diff(dir string, env []string) (string, error) {
+	return run(dir, env, "diff", "HEAD", "--binary")
+}
+
+// UntrackedFiles returns the files not tracked by git, excluding the ignored ones
+func UntrackedFiles(dir string, env []string) ([]string, error) {
+	output, err := run(dir, env, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
@@ -0,0 +1,176 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ActionRecord holds the result of an action executed on a repository
+type ActionRecord struct {
+	Repository string        `json:"repository"`
+	Action     string        `json:"action"`
+	Duration   time.Duration `json:"duration"`
+	ExitCode   int           `json:"exitCode"`
+	Error      string        `json:"error,omitempty"`
+	LogPath    string        `json:"logPath,omitempty"`
+	// Skipped is set when the action had nothing to do, like when its cached inputs did not change. Its duration
+	// is left out of the comparisons
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Run holds the record of a repository command invocation
+type Run struct {
+	ID           string         `json:"id"`
+	Command      string         `json:"command"`
+	StartedAt    time.Time      `json:"startedAt"`
+	Duration     time.Duration  `json:"duration"`
+	Repositories []string       `json:"repositories"`
+	ExitCode     int            `json:"exitCode"`
+	Actions      []ActionRecord `json:"actions"`
+
+	mu sync.Mutex
+}
+
+// NewRun returns a Run for the command, started now
+func NewRun(command string, repositories []string) *Run {
+	now := time.Now()
+	return &Run{
+		ID:           now.Format("20060102-150405.000"),
+		Command:      command,
+		StartedAt:    now,
+		Repositories: repositories,
+	}
+}
+
+// Add records the result of an action. It is safe to call from several goroutines
+func (r *Run) Add(record ActionRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Actions = append(r.Actions, record)
+}
+
+// Finish sets the exit code and duration of the run
+func (r *Run) Finish(exitCode int) {
+	r.ExitCode = exitCode
+	r.Duration = time.Since(r.StartedAt)
+}
+
+// Failed checks if any of the actions of the run failed
+func (r *Run) Failed() bool {
+	return r.ExitCode != 0
+}
+
+// MaxRuns is how many runs are kept. The oldest ones are removed along with their logs when exceeded
+const MaxRuns = 200
+
+// Store persists the runs as JSON lines in a file
+type Store struct {
+	dir  string
+	path string
+}
+
+// NewStore returns a Store keeping the runs in the given directory
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, path: filepath.Join(dir, "history.jsonl")}
+}
+
+// LogsDir returns the directory the output of the actions of the run is kept in
+func (s *Store) LogsDir(runID string) string {
+	return filepath.Join(s.dir, "logs", runID)
+}
+
+// Append adds the run at the end of the store, removing the oldest runs beyond MaxRuns
+func (s *Store) Append(run *Run) error {
+	if err := s.append(run); err != nil {
+		return err
+	}
+	return s.prune(MaxRuns)
+}
+
+func (s *Store) append(run *Run) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// prune keeps the latest runs, removing the logs of the older ones
+func (s *Store) prune(keep int) error {
+	runs, err := s.Load()
+	if err != nil || len(runs) <= keep {
+		return err
+	}
+	removed, kept := runs[:len(runs)-keep], runs[len(runs)-keep:]
+
+	var content []byte
+	for _, run := range kept {
+		line, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		content = append(append(content, line...), '\n')
+	}
+	// Written to a temporary file first, so the history is never left half written
+	temp := s.path + ".tmp"
+	if err := os.WriteFile(temp, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, s.path); err != nil {
+		return err
+	}
+	for _, run := range removed {
+		if err := os.RemoveAll(s.LogsDir(run.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load returns all the stored runs, oldest first
+func (s *Store) Load() ([]*Run, error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var runs []*Run
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		run := &Run{}
+		if err := json.Unmarshal(scanner.Bytes(), run); err != nil {
+			return nil, fmt.Errorf("invalid history record on line %d: %w", line, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
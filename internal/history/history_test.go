@@ -0,0 +1,64 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendKeepsTheLatestRuns(t *testing.T) {
+	store := NewStore(t.TempDir())
+	var ids []string
+	for i := range 5 {
+		run := &Run{ID: fmt.Sprintf("run-%d", i), Command: "build"}
+		ids = append(ids, run.ID)
+		if err := os.MkdirAll(store.LogsDir(run.ID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.append(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.prune(3); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || runs[0].ID != "run-2" || runs[2].ID != "run-4" {
+		t.Fatalf("unexpected runs kept %v", runs)
+	}
+	for i, id := range ids {
+		_, err := os.Stat(store.LogsDir(id))
+		if removed := os.IsNotExist(err); removed != (i < 2) {
+			t.Errorf("logs of %v removed: %v", id, removed)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(store.path), "history.jsonl.tmp")); err == nil {
+		t.Error("temporary file left behind")
+	}
+}
+
+func TestPreviousDurationsSkipsCachedActions(t *testing.T) {
+	record := func(duration time.Duration, exitCode int, skipped bool) *Run {
+		return &Run{Actions: []ActionRecord{{Repository: "app1", Action: "build", Duration: duration, ExitCode: exitCode, Skipped: skipped}}}
+	}
+	runs := []*Run{
+		record(10*time.Second, 0, false),
+		record(time.Millisecond, 0, true),
+		record(20*time.Second, 0, false),
+		record(time.Second, 1, false),
+		record(2*time.Millisecond, 0, true),
+	}
+	last, average, found := previousDurations(runs, ActionRecord{Repository: "app1", Action: "build"})
+	if !found || last != 20*time.Second || average != 15*time.Second {
+		t.Errorf("got last %v and average %v", last, average)
+	}
+	if _, _, found := previousDurations(runs[1:2], ActionRecord{Repository: "app1", Action: "build"}); found {
+		t.Error("found durations of skipped actions only")
+	}
+}
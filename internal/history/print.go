@@ -0,0 +1,106 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// PrintRuns writes the runs as a table to stdout, most recent first
+func PrintRuns(runs []*Run) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCOMMAND\tSTARTED\tDURATION\tREPOSITORIES\tEXIT CODE")
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%d\t%d\n",
+			run.ID, run.Command, run.StartedAt.Format(time.DateTime), run.Duration.Round(time.Millisecond), len(run.Repositories), run.ExitCode)
+	}
+	tw.Flush()
+}
+
+// PrintRun writes the actions of the run as a table to stdout
+func PrintRun(run *Run) {
+	fmt.Printf("Run %v - %v - started %v - took %v - exit code %d\n",
+		run.ID, run.Command, run.StartedAt.Format(time.DateTime), run.Duration.Round(time.Millisecond), run.ExitCode)
+
+	actions := make([]ActionRecord, len(run.Actions))
+	copy(actions, run.Actions)
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Repository < actions[j].Repository
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tACTION\tDURATION\tEXIT CODE\tLOG\tERROR")
+	for _, action := range actions {
+		logPath := action.LogPath
+		if logPath == "" {
+			logPath = "-"
+		}
+		duration := action.Duration.Round(time.Millisecond).String()
+		if action.Skipped {
+			duration = "skipped"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%d\t%v\t%v\n",
+			action.Repository, action.Action, duration, action.ExitCode, logPath, action.Error)
+	}
+	tw.Flush()
+}
+
+// PrintComparison writes, for each repository and action of the latest run, its duration compared with
+// the previous run and with the average of all the previous successful ones. The skipped actions are left out
+func PrintComparison(runs []*Run) {
+	if len(runs) == 0 {
+		return
+	}
+	latest := runs[len(runs)-1]
+	previous := runs[:len(runs)-1]
+
+	fmt.Printf("Comparing run %v - %v against %d previous run/s\n", latest.ID, latest.Command, len(previous))
+
+	actions := make([]ActionRecord, len(latest.Actions))
+	copy(actions, latest.Actions)
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Repository < actions[j].Repository
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tACTION\tDURATION\tPREVIOUS\tAVERAGE\tCHANGE")
+	for _, action := range actions {
+		if action.Skipped {
+			fmt.Fprintf(tw, "%v\t%v\tskipped\t-\t-\t-\n", action.Repository, action.Action)
+			continue
+		}
+		last, average, found := previousDurations(previous, action)
+		if !found {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t-\t-\t-\n", action.Repository, action.Action, action.Duration.Round(time.Millisecond))
+			continue
+		}
+		change := float64(action.Duration-average) / float64(average) * 100
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%+.1f%%\n",
+			action.Repository, action.Action, action.Duration.Round(time.Millisecond), last.Round(time.Millisecond), average.Round(time.Millisecond), change)
+	}
+	tw.Flush()
+}
+
+// previousDurations returns the duration of the action on the last of the runs and its average, counting only
+// the runs where it succeeded and was not skipped
+func previousDurations(runs []*Run, action ActionRecord) (time.Duration, time.Duration, bool) {
+	var last, total time.Duration
+	count := 0
+	for _, run := range runs {
+		for _, record := range run.Actions {
+			if record.Repository != action.Repository || record.Action != action.Action || record.ExitCode != 0 || record.Skipped {
+				continue
+			}
+			last = record.Duration
+			total += record.Duration
+			count++
+		}
+	}
+	if count == 0 || total == 0 {
+		return 0, 0, false
+	}
+	return last, total / time.Duration(count), true
+}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"titan/internal/utils"
+	"titan/pkg/types"
+
+	"github.com/lmittmann/tint"
+)
+
+const (
+	// TEXT logs using key=value pairs
+	TEXT = "text"
+	// JSON logs a JSON object per line
+	JSON = "json"
+	// PRETTY logs in a human friendly way, coloured when writing to a terminal
+	PRETTY = "pretty"
+)
+
+// Merge returns the logging configuration with the values of overrides, when set, taking precedence
+func Merge(config types.Logging, overrides types.Logging) types.Logging {
+	if overrides.Level != "" {
+		config.Level = overrides.Level
+	}
+	if overrides.Format != "" {
+		config.Format = overrides.Format
+	}
+	if overrides.File != "" {
+		config.File = overrides.File
+	}
+	return config
+}
+
+// ParseLevel returns the slog level for the given name, defaulting to info when empty
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q, valid ones are debug, info, warn and error", level)
+}
+
+// NewHandler returns the slog handler for the logging configuration. When a file is configured the logs
+// are appended to it instead of the given writer, stderr if nil
+func NewHandler(config types.Logging, w io.Writer) (slog.Handler, error) {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	if w == nil {
+		w = os.Stderr
+	}
+	if config.File != "" {
+		path := utils.PathWithUserHome(config.File)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		// The file is kept open for the lifetime of the process
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = file
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	switch config.Format {
+	case "", PRETTY:
+		return tint.NewHandler(w, &tint.Options{
+			Level:      level,
+			TimeFormat: time.Kitchen,
+			NoColor:    !useColor(w),
+		}), nil
+	case TEXT:
+		return slog.NewTextHandler(w, options), nil
+	case JSON:
+		return slog.NewJSONHandler(w, options), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, valid ones are text, json and pretty", config.Format)
+}
+
+// useColor checks if colours should be used when writing to w. They are disabled when NO_COLOR is set
+// or w is not a terminal
+func useColor(w io.Writer) bool {
+	if _, found := os.LookupEnv("NO_COLOR"); found {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,161 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"titan/internal/core"
+	"titan/internal/events"
+	"titan/internal/proxy"
+	"titan/internal/tasks"
+)
+
+// DEFAULT_PATH is the path the metrics are served on when none is configured
+const DEFAULT_PATH = "/metrics"
+
+// Handler returns the handler serving the metrics of the proxy and tasks in Prometheus text format
+func Handler(proxy *proxy.Proxy, tasks *tasks.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w, proxy.Metrics().Snapshot(), tasks.States())
+	})
+}
+
+// Write writes the proxy metrics and task states in Prometheus text format
+func Write(out io.Writer, snapshot proxy.MetricsSnapshot, states []tasks.State) error {
+	w := bufio.NewWriter(out)
+	routes := make([]string, 0, len(snapshot.Routes))
+	for name := range snapshot.Routes {
+		routes = append(routes, name)
+	}
+	sort.Strings(routes)
+
+	header(w, "titan_proxy_uptime_seconds", "gauge", "Time since the proxy started")
+	sample(w, "titan_proxy_uptime_seconds", nil, float64(snapshot.UptimeMs)/1000)
+
+	header(w, "titan_proxy_connections", "gauge", "Client connections open, upgraded ones excluded")
+	sample(w, "titan_proxy_connections", nil, float64(snapshot.Connections))
+
+	header(w, "titan_proxy_requests_total", "counter", "Requests handled by each route, by status class")
+	for _, route := range routes {
+		metrics := snapshot.Routes[route]
+		classes := make([]string, 0, len(metrics.Statuses))
+		for class := range metrics.Statuses {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			sample(w, "titan_proxy_requests_total", []string{"route", route, "code", class}, float64(metrics.Statuses[class]))
+		}
+	}
+
+	header(w, "titan_proxy_requests_in_flight", "gauge", "Requests being handled by each route")
+	for _, route := range routes {
+		sample(w, "titan_proxy_requests_in_flight", []string{"route", route}, float64(snapshot.Routes[route].InFlight))
+	}
+
+	header(w, "titan_proxy_upstream_errors_total", "counter", "Requests of each route that failed reaching the upstream")
+	for _, route := range routes {
+		sample(w, "titan_proxy_upstream_errors_total", []string{"route", route}, float64(snapshot.Routes[route].UpstreamErrors))
+	}
+
+	header(w, "titan_proxy_response_bytes_total", "counter", "Bytes of the responses of each route")
+	for _, route := range routes {
+		sample(w, "titan_proxy_response_bytes_total", []string{"route", route}, float64(snapshot.Routes[route].Bytes))
+	}
+
+	header(w, "titan_proxy_request_duration_seconds", "histogram", "Time spent handling the requests of each route")
+	for _, route := range routes {
+		metrics := snapshot.Routes[route]
+		var cumulative int64
+		for i, bound := range proxy.LatencyBuckets {
+			cumulative += metrics.LatencyBuckets[i]
+			sample(w, "titan_proxy_request_duration_seconds_bucket", []string{"route", route, "le", formatFloat(bound)}, float64(cumulative))
+		}
+		sample(w, "titan_proxy_request_duration_seconds_bucket", []string{"route", route, "le", "+Inf"}, float64(metrics.Requests))
+		sample(w, "titan_proxy_request_duration_seconds_sum", []string{"route", route}, metrics.LatencyMs/1000)
+		sample(w, "titan_proxy_request_duration_seconds_count", []string{"route", route}, float64(metrics.Requests))
+	}
+
+	header(w, "titan_task_up", "gauge", "Whether the task is running")
+	for _, state := range states {
+		up := 0.0
+		if state.State == tasks.RUNNING {
+			up = 1
+		}
+		sample(w, "titan_task_up", []string{"task", state.Name}, up)
+	}
+
+	header(w, "titan_task_uptime_seconds", "gauge", "Time since the task last started, 0 when not running")
+	for _, state := range states {
+		sample(w, "titan_task_uptime_seconds", []string{"task", state.Name}, float64(state.UptimeMs)/1000)
+	}
+
+	header(w, "titan_task_restarts_total", "counter", "Times the task was restarted")
+	for _, state := range states {
+		sample(w, "titan_task_restarts_total", []string{"task", state.Name}, float64(state.Restarts))
+	}
+
+	return w.Flush()
+}
+
+// Start starts the metrics server when configured. Errors from the running server are sent to the error channel
+func Start(errorChannel chan error, container *core.Container, handler http.Handler) {
+	config := container.ConfigData.Config.Server.Metrics
+	if config.Port == 0 {
+		return
+	}
+	host := config.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	path := config.Path
+	if path == "" {
+		path = DEFAULT_PATH
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET "+path, handler)
+	go func() {
+		addr := fmt.Sprintf("%s:%d", host, config.Port)
+		container.Logger.Info("starting metrics server", "address", addr, "path", path)
+		container.Events.Emit(events.Event{Type: events.SERVER_STARTED, State: "metrics", Data: addr})
+		server := &http.Server{
+			Addr:     addr,
+			Handler:  mux,
+			ErrorLog: slog.NewLogLogger(container.Logger.Handler(), slog.LevelError),
+		}
+		if err := server.ListenAndServe(); err != nil {
+			errorChannel <- err
+		}
+	}()
+}
+
+func header(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample of the metric. Labels are given as name and value pairs
+func sample(w io.Writer, name string, labels []string, value float64) {
+	io.WriteString(w, name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+		}
+		io.WriteString(w, "{"+strings.Join(pairs, ",")+"}")
+	}
+	io.WriteString(w, " "+formatFloat(value)+"\n")
+}
+
+// labelEscaper escapes the label values as the Prometheus text format expects
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
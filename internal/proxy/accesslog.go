@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// Access log formats
+const (
+	COMMON   = "common"
+	COMBINED = "combined"
+	JSON     = "json"
+)
+
+// accessEntry holds the routing data of a request, filled by the route handling it
+type accessEntry struct {
+	route    string
+	upstream string
+	skip     bool
+	// upstreamErr is the error reaching the upstream, if any
+	upstreamErr error
+}
+
+type accessEntryKey struct{}
+
+// getAccessEntry returns the access entry of the request, if the access log is enabled
+func getAccessEntry(r *http.Request) *accessEntry {
+	entry, _ := r.Context().Value(accessEntryKey{}).(*accessEntry)
+	return entry
+}
+
+// responseRecorder captures the status and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	// reset is set when the connection is closed on purpose without answering, so no status was sent
+	reset bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += int64(n)
+	return n, err
+}
+
+// Flush allows streaming responses through the recorder
+func (rr *responseRecorder) Flush() {
+	if flusher, ok := rr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack allows upgraded connections through the recorder
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if rr.status == 0 && !rr.reset {
+		rr.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// AccessLog writes an entry for every request handled by the proxy
+type AccessLog struct {
+	format string
+	logger *slog.Logger
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// NewAccessLog returns the AccessLog for the configuration, or nil if disabled. Entries are written to
+// the configured file or, if none, to the logger
+func NewAccessLog(config types.AccessLog, logger *slog.Logger) (*AccessLog, error) {
+	format := config.Format
+	if format == "" {
+		format = COMBINED
+	}
+	if format != COMMON && format != COMBINED && format != JSON {
+		return nil, fmt.Errorf("invalid access log format %q, valid ones are common, combined and json", format)
+	}
+
+	accessLog := &AccessLog{format: format, logger: logger}
+	if config.File != "" {
+		path := utils.PathWithUserHome(config.File)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		// The file is kept open for the lifetime of the server
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		accessLog.w = file
+	}
+	return accessLog, nil
+}
+
+// Middleware logs the requests handled by next
+func (al *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{}
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+		if entry.skip {
+			return
+		}
+		al.write(r, recorder, entry, time.Since(start))
+	})
+}
+
+func (al *AccessLog) write(r *http.Request, recorder *responseRecorder, entry *accessEntry, latency time.Duration) {
+	// Connections reset are logged with a 0 status
+	status := recorder.status
+	if status == 0 && !recorder.reset {
+		status = http.StatusOK
+	}
+	clientIP := getClientIP(r)
+	route := valueOrDash(entry.route)
+	upstream := valueOrDash(entry.upstream)
+
+	if al.w == nil {
+		if al.format == JSON {
+			al.logger.Info("proxied request",
+				"client", clientIP, "method", r.Method, "path", r.URL.RequestURI(), "proto", r.Proto,
+				"status", status, "bytes", recorder.bytes, "route", route, "upstream", upstream,
+				"latency", latency, "referer", r.Referer(), "userAgent", r.UserAgent())
+			return
+		}
+		al.logger.Info(al.line(r, clientIP, status, recorder.bytes, route, upstream, latency))
+		return
+	}
+
+	var line string
+	if al.format == JSON {
+		data, err := json.Marshal(map[string]any{
+			"time":      time.Now().Format(time.RFC3339Nano),
+			"client":    clientIP,
+			"method":    r.Method,
+			"path":      r.URL.RequestURI(),
+			"proto":     r.Proto,
+			"status":    status,
+			"bytes":     recorder.bytes,
+			"route":     route,
+			"upstream":  upstream,
+			"latencyMs": float64(latency.Microseconds()) / 1000,
+			"referer":   r.Referer(),
+			"userAgent": r.UserAgent(),
+		})
+		if err != nil {
+			return
+		}
+		line = string(data)
+	} else {
+		line = al.line(r, clientIP, status, recorder.bytes, route, upstream, latency)
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	fmt.Fprintln(al.w, line)
+}
+
+// line returns the entry in common or combined format, followed by the route, upstream and latency
+func (al *AccessLog) line(r *http.Request, clientIP string, status int, bytes int64, route string, upstream string, latency time.Duration) string {
+	line := fmt.Sprintf("%s - - [%s] %q %d %d",
+		clientIP, time.Now().Format("02/Jan/2006:15:04:05 -0700"), r.Method+" "+r.URL.RequestURI()+" "+r.Proto, status, bytes)
+	if al.format == COMBINED {
+		line += fmt.Sprintf(" %q %q", valueOrDash(r.Referer()), valueOrDash(r.UserAgent()))
+	}
+	return fmt.Sprintf("%s %q %q %v", line, route, upstream, latency.Round(time.Microsecond))
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+	"titan/pkg/types"
+)
+
+// Load balancing strategies
+const (
+	ROUND_ROBIN       = "round-robin"
+	LEAST_CONNECTIONS = "least-connections"
+	RANDOM            = "random"
+)
+
+// Defaults for the passive ejection of failing targets
+const (
+	defaultEjectAfter = 3
+	defaultEjectFor   = 30 * time.Second
+)
+
+// routeTargets returns the targets of the route, either the single target or the list of them
+func routeTargets(route types.Route) []string {
+	if len(route.Targets) > 0 {
+		return route.Targets
+	}
+	return []string{route.Target}
+}
+
+// backend is a target of a route along with the handler proxying to it
+type backend struct {
+	target  *url.URL
+	handler http.Handler
+	// health checks the target, nil when checks are not configured
+	health *healthChecker
+	// transport is the dedicated transport of the route, nil when it uses the shared one. Its idle connections
+	// are closed when the routes are replaced
+	transport *http.Transport
+	// id identifies the target on the sticky cookie. It is derived from the URL so it survives reloads
+	id string
+	// active counts the requests in flight to the target
+	active atomic.Int64
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+}
+
+func newBackend(target *url.URL) *backend {
+	hash := fnv.New64a()
+	hash.Write([]byte(target.String()))
+	return &backend{target: target, id: fmt.Sprintf("%x", hash.Sum64())}
+}
+
+// available indicates if requests can be sent to the target, as it is neither unhealthy nor ejected
+func (b *backend) available(now time.Time) bool {
+	if b.health.status() == UNHEALTHY {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.ejectedUntil)
+}
+
+func (b *backend) ejected(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Before(b.ejectedUntil)
+}
+
+// balancer spreads the requests of a route across its backends. Failing backends are left out for a while,
+// as are the unhealthy ones when health checks are configured
+type balancer struct {
+	route      string
+	backends   []*backend
+	strategy   string
+	sticky     string
+	ejectAfter int
+	ejectFor   time.Duration
+	// next is the position of the next backend picked by round-robin
+	next atomic.Uint64
+}
+
+func newBalancer(route string, backends []*backend, config types.Balance) *balancer {
+	return &balancer{
+		route:      route,
+		backends:   backends,
+		strategy:   valueOrDefault(config.Strategy, ROUND_ROBIN),
+		sticky:     config.StickyCookie,
+		ejectAfter: valueOrDefault(config.EjectAfter, defaultEjectAfter),
+		ejectFor:   valueOrDefault(config.EjectFor, defaultEjectFor),
+	}
+}
+
+func (lb *balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	backend := lb.pick(r)
+	if lb.sticky != "" {
+		if cookie, err := r.Cookie(lb.sticky); err != nil || cookie.Value != backend.id {
+			http.SetCookie(w, &http.Cookie{Name: lb.sticky, Value: backend.id, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+		}
+	}
+	backend.active.Add(1)
+	defer backend.active.Add(-1)
+	backend.handler.ServeHTTP(w, r)
+}
+
+// pick returns the backend for the request. When none is available all of them are considered, so requests
+// still get an answer, like the error page
+func (lb *balancer) pick(r *http.Request) *backend {
+	now := time.Now()
+	candidates := make([]*backend, 0, len(lb.backends))
+	for _, backend := range lb.backends {
+		if backend.available(now) {
+			candidates = append(candidates, backend)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = lb.backends
+	}
+
+	if lb.sticky != "" {
+		if cookie, err := r.Cookie(lb.sticky); err == nil {
+			for _, backend := range candidates {
+				if backend.id == cookie.Value {
+					return backend
+				}
+			}
+		}
+	}
+
+	switch lb.strategy {
+	case LEAST_CONNECTIONS:
+		picked := candidates[0]
+		for _, backend := range candidates[1:] {
+			if backend.active.Load() < picked.active.Load() {
+				picked = backend
+			}
+		}
+		return picked
+	case RANDOM:
+		return candidates[rand.IntN(len(candidates))]
+	}
+	return candidates[(lb.next.Add(1)-1)%uint64(len(candidates))]
+}
+
+// observe counts the consecutive failures reaching the backend, ejecting it once they reach the limit. A
+// success resets them
+func (lb *balancer) observe(backend *backend, err error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if err == nil {
+		backend.failures = 0
+		return
+	}
+	backend.failures++
+	if backend.failures >= lb.ejectAfter {
+		backend.failures = 0
+		backend.ejectedUntil = time.Now().Add(lb.ejectFor)
+		slog.Warn("upstream ejected", "route", lb.route, "target", backend.target.String(), "for", lb.ejectFor, "error", err)
+	}
+}
+
+// observedTransport reports the result of every request sent to the backend to the balancer
+type observedTransport struct {
+	next     http.RoundTripper
+	balancer *balancer
+	backend  *backend
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	// Requests canceled by the client are not a failure of the backend
+	if req.Context().Err() == nil {
+		t.balancer.observe(t.backend, upstreamFailure(resp, err))
+	}
+	return resp, err
+}
+
+// upstreamFailure returns the error of the request sent to the backend, which is either the error reaching it or
+// a response telling it cannot serve requests, like a gateway in front of it not reaching the app
+func upstreamFailure(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("upstream answered %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"titan/pkg/types"
+)
+
+// defaultCORSMethods are the methods allowed when none are configured
+var defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// corsPolicy answers the preflight requests of a route and adds the CORS headers to its responses
+type corsPolicy struct {
+	anyOrigin        bool
+	origins          []string
+	methods          string
+	headers          string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// newCORSPolicy returns the policy of the route, nil when none is configured
+func newCORSPolicy(config *types.CORS) *corsPolicy {
+	if config == nil {
+		return nil
+	}
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	policy := &corsPolicy{
+		anyOrigin:        slices.Contains(config.AllowOrigins, "*"),
+		origins:          config.AllowOrigins,
+		methods:          strings.Join(methods, ", "),
+		headers:          strings.Join(config.AllowHeaders, ", "),
+		exposeHeaders:    strings.Join(config.ExposeHeaders, ", "),
+		allowCredentials: config.AllowCredentials,
+	}
+	if config.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+	return policy
+}
+
+func (c *corsPolicy) allowed(origin string) bool {
+	return origin != "" && (c.anyOrigin || slices.Contains(c.origins, origin))
+}
+
+// allowOrigin sets the origin allowed. The origin is echoed back unless any is allowed without credentials,
+// as browsers reject "*" along with credentials
+func (c *corsPolicy) allowOrigin(header http.Header, origin string) {
+	header.Add("Vary", "Origin")
+	if c.anyOrigin && !c.allowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight answers the request if it is a preflight one, returning true when answered
+func (c *corsPolicy) preflight(w http.ResponseWriter, r *http.Request) bool {
+	if c == nil || r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if !c.allowed(origin) {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	header := w.Header()
+	c.allowOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", c.methods)
+	allowHeaders := c.headers
+	if allowHeaders == "" {
+		allowHeaders = r.Header.Get("Access-Control-Request-Headers")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if allowHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+	}
+	if c.maxAge != "" {
+		header.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// apply replaces the CORS headers of the response with the ones of the policy
+func (c *corsPolicy) apply(header http.Header, r *http.Request) {
+	if c == nil {
+		return
+	}
+	for name := range header {
+		if strings.HasPrefix(name, "Access-Control-") {
+			header.Del(name)
+		}
+	}
+	origin := r.Header.Get("Origin")
+	if !c.allowed(origin) {
+		return
+	}
+	c.allowOrigin(header, origin)
+	if c.exposeHeaders != "" {
+		header.Set("Access-Control-Expose-Headers", c.exposeHeaders)
+	}
+}
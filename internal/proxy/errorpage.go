@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"titan/internal/tasks"
+)
+
+// errorPageLogLines is how many of the latest output lines of the task are shown on the error page
+const errorPageLogLines = 30
+
+// errorPageRefresh is how often, in seconds, the error page reloads itself
+const errorPageRefresh = 3
+
+//go:embed error.html
+var errorPageHTML string
+
+var errorPageTemplate = template.Must(template.New("error").Parse(errorPageHTML))
+
+// errorPage holds what is shown when a route cannot reach its target
+type errorPage struct {
+	Status string
+	Route  string
+	Target string
+	Error  string
+	Health string
+	// Task is the task configured on the route, State is nil when it is not part of the profile
+	Task  string
+	State *tasks.State
+	Logs  []string
+	// Refresh is how often, in seconds, the page reloads itself. Zero to not reload it
+	Refresh int
+}
+
+// newErrorPage describes the failure of the route reaching the backend, along with the state and latest output
+// of the task serving it
+func newErrorPage(route *Route, backend *backend, err error, manager *tasks.Manager) errorPage {
+	page := errorPage{
+		Status: fmt.Sprintf("%d %v", http.StatusBadGateway, http.StatusText(http.StatusBadGateway)),
+		Route:  route.Name,
+		Target: backend.target.String(),
+		Error:  err.Error(),
+		Health: backend.health.status(),
+		Task:   route.task,
+	}
+	if route.task == "" || manager == nil {
+		return page
+	}
+	for _, state := range manager.States() {
+		if state.Name == route.task || strings.HasPrefix(state.Name, route.task+":") {
+			page.State = &state
+			break
+		}
+	}
+	if page.State != nil {
+		lines, _ := manager.Logs(page.State.Name, errorPageLogLines)
+		for _, line := range lines {
+			page.Logs = append(page.Logs, tasks.StripANSI(line))
+		}
+	}
+	return page
+}
+
+// write sends the page as HTML to browsers and as plain text to other clients
+func (page errorPage) write(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "%v: route [%v] could not reach %v: %v\n", page.Status, page.Route, page.Target, page.Error)
+		if page.State != nil {
+			fmt.Fprintf(w, "task [%v] is %v\n", page.State.Name, page.State.State)
+		}
+		return
+	}
+	// Reloading only repeats requests that are safe to repeat
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		page.Refresh = errorPageRefresh
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadGateway)
+	errorPageTemplate.Execute(w, page)
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"titan/pkg/types"
+)
+
+// defaultFaultStatus is the status of the injected errors when none is configured
+const defaultFaultStatus = http.StatusServiceUnavailable
+
+// throttleSteps is how many times per second the throttled responses are sent
+const throttleSteps = 10
+
+// errFaultReset is logged as the upstream error of the connections reset on purpose
+var errFaultReset = errors.New("connection reset injected")
+
+// faultInjector delays, throttles or fails the requests of a route matching its faults. The faults set while
+// running replace the configured ones
+type faultInjector struct {
+	route       string
+	stripPrefix string
+	configured  []types.Fault
+	// overrides returns the faults set while running for the route, if any
+	overrides func(route string) ([]types.Fault, bool)
+	next      http.Handler
+}
+
+// newFaultInjector returns the faultInjector of the route. The faults match the path only stripped of the prefix,
+// as the mock responses do
+func newFaultInjector(name string, route types.Route, overrides func(string) ([]types.Fault, bool), next http.Handler) *faultInjector {
+	return &faultInjector{route: name, stripPrefix: routeStripPrefix(route), configured: route.Faults, overrides: overrides, next: next}
+}
+
+// faults returns the enabled faults matching the request
+func (fi *faultInjector) faults(r *http.Request) []types.Fault {
+	faults := fi.configured
+	if overridden, found := fi.overrides(fi.route); found {
+		faults = overridden
+	}
+	if len(faults) == 0 {
+		return nil
+	}
+	path := localPath(r.URL, fi.stripPrefix)
+	var matching []types.Fault
+	for _, fault := range faults {
+		if fault.Disabled || (fault.Method != "" && !strings.EqualFold(fault.Method, r.Method)) {
+			continue
+		}
+		if _, found := matchPathPattern(fault.Path, path); found {
+			matching = append(matching, fault)
+		}
+	}
+	return matching
+}
+
+func (fi *faultInjector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	faults := fi.faults(r)
+	if len(faults) == 0 {
+		fi.next.ServeHTTP(w, r)
+		return
+	}
+	var bandwidth int64
+	for _, fault := range faults {
+		delay := fault.Latency
+		if fault.Jitter > 0 {
+			delay += rand.N(fault.Jitter)
+		}
+		if !sleep(r.Context(), delay) {
+			return
+		}
+		if fault.ResetRate > 0 && rand.Float64() < fault.ResetRate {
+			resetConnection(w, r)
+			return
+		}
+		if fault.ErrorRate > 0 && rand.Float64() < fault.ErrorRate {
+			http.Error(w, "fault injected", valueOrDefault(fault.ErrorStatus, defaultFaultStatus))
+			return
+		}
+		// The lowest bandwidth applies when several faults limit it
+		if fault.Bandwidth > 0 && (bandwidth == 0 || fault.Bandwidth < bandwidth) {
+			bandwidth = fault.Bandwidth
+		}
+	}
+	if bandwidth > 0 {
+		w = &throttledWriter{ResponseWriter: w, ctx: r.Context(), bandwidth: bandwidth}
+	}
+	fi.next.ServeHTTP(w, r)
+}
+
+// sleep waits for the delay, returning false when the request is cancelled meanwhile
+func sleep(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// resetConnection closes the connection of the request without answering it. TCP connections are reset, so
+// the client gets an error rather than an empty response
+func resetConnection(w http.ResponseWriter, r *http.Request) {
+	if entry := getAccessEntry(r); entry != nil {
+		entry.upstreamErr = errFaultReset
+	}
+	// The recorders would take the hijacking for an upgrade otherwise
+	for writer := w; writer != nil; {
+		if recorder, ok := writer.(*responseRecorder); ok {
+			recorder.reset = true
+		}
+		unwrapper, ok := writer.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		writer = unwrapper.Unwrap()
+	}
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// HTTP/2 connections cannot be hijacked, aborting the handler resets the stream instead
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// throttledWriter sends the response at the given bytes per second, flushing each part so the client gets
+// them as they are sent
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx       context.Context
+	bandwidth int64
+}
+
+func (tw *throttledWriter) Write(b []byte) (int, error) {
+	step := max(tw.bandwidth/throttleSteps, 1)
+	written := 0
+	for written < len(b) {
+		part := b[written:min(len(b), written+int(step))]
+		n, err := tw.ResponseWriter.Write(part)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		http.NewResponseController(tw.ResponseWriter).Flush()
+		if !sleep(tw.ctx, time.Duration(n)*time.Second/time.Duration(tw.bandwidth)) {
+			return written, fmt.Errorf("throttled response: %w", tw.ctx.Err())
+		}
+	}
+	return written, nil
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"titan/pkg/types"
+)
+
+func TestResetsAreRecordedAsErrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	proxy := newTestProxy()
+	// The CORS policy puts a headerWriter between the recorders and the fault injector
+	err := proxy.SetRoutes(types.Server{AccessLog: types.AccessLog{Enabled: true}, Routes: map[string]types.Route{
+		"api": {Source: "/api", Target: upstream.URL, CORS: &types.CORS{AllowOrigins: []string{"*"}},
+			Faults: []types.Fault{{Path: "/reset", ResetRate: 1}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &lockedBuffer{}
+	accessLog, err := NewAccessLog(types.AccessLog{Enabled: true, Format: JSON}, slog.New(slog.NewJSONHandler(logs, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(accessLog.Middleware(proxy.handler(true)))
+	defer server.Close()
+
+	if _, err := http.Get(server.URL + "/api/reset"); err == nil {
+		t.Fatal("expected the connection to be reset")
+	}
+	response, err := http.Get(server.URL + "/api/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(logs.String(), "proxied request") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(logs.String(), `"path":"/api/reset","proto":"HTTP/1.1","status":0`) {
+		t.Errorf("reset not logged with a 0 status:\n%v", logs.String())
+	}
+	metrics := proxy.Metrics().Snapshot().Routes["api"]
+	if metrics.Statuses[RESET] != 1 || metrics.Statuses["1xx"] != 0 || metrics.Statuses["2xx"] != 1 {
+		t.Errorf("unexpected statuses %v", metrics.Statuses)
+	}
+	if metrics.Errors != 1 || metrics.UpstreamErrors != 1 {
+		t.Errorf("got %d errors and %d upstream errors", metrics.Errors, metrics.UpstreamErrors)
+	}
+}
+
+func TestLocalHandlersOnlyStripThePrefix(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "users.json"), []byte("static"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The prefix to add and the rewrite rules only apply to the upstream path, so they must be ignored
+	rewrites := types.Route{AddPrefix: stringPtr("/v2"), Rewrite: []types.RewriteRule{{Match: "^/users", Replace: "/people"}}}
+	static, mock, faults := rewrites, rewrites, rewrites
+	static.Source, static.Static = "/static", &types.Static{Dir: dir}
+	mock.Source, mock.Mock = "/mock", &types.Mock{Responses: []types.MockResponse{{Path: "/users.json", Body: "mock"}}}
+	faults.Source, faults.Target = "/faults", "http://127.0.0.1:1"
+	faults.Faults = []types.Fault{{Path: "/users.json", ErrorRate: 1, ErrorStatus: http.StatusTeapot}}
+
+	proxy := newTestProxy()
+	routes, err := proxy.buildRoutes(types.Server{Routes: map[string]types.Route{"static": static, "mock": mock, "faults": faults}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		request string
+		status  int
+		body    string
+	}{
+		{"/static/users.json", http.StatusOK, "static"},
+		{"/static/v2/people.json", http.StatusNotFound, ""},
+		{"/mock/users.json", http.StatusOK, "mock"},
+		{"/faults/users.json", http.StatusTeapot, "fault injected\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.request, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, test.request, nil)
+			route := matchRoute(routes, request, func(string) bool { return false })
+			recorder := httptest.NewRecorder()
+			route.handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.status)
+			}
+			if test.body != "" && !strings.Contains(recorder.Body.String(), test.body) {
+				t.Errorf("got body %q, want %q", recorder.Body.String(), test.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"titan/pkg/types"
+)
+
+// headerRules holds the changes made to the headers of the route requests or responses
+type headerRules struct {
+	route  string
+	remove []string
+	set    map[string]string
+	add    map[string]string
+}
+
+// newHeaderRules returns the rules of the route, nil when there are none
+func newHeaderRules(route string, config types.HeaderRules) *headerRules {
+	if len(config.Remove) == 0 && len(config.Set) == 0 && len(config.Add) == 0 {
+		return nil
+	}
+	return &headerRules{route: route, remove: config.Remove, set: config.Set, add: config.Add}
+}
+
+// apply removes, sets and adds the headers, replacing the placeholders of the values with the ones of the
+// request r
+func (hr *headerRules) apply(header http.Header, r *http.Request) {
+	if hr == nil {
+		return
+	}
+	replacer := hr.placeholders(r)
+	for _, name := range hr.remove {
+		header.Del(name)
+	}
+	for name, value := range hr.set {
+		header.Set(name, replacer.Replace(value))
+	}
+	for name, value := range hr.add {
+		header.Add(name, replacer.Replace(value))
+	}
+}
+
+func (hr *headerRules) placeholders(r *http.Request) *strings.Replacer {
+	return strings.NewReplacer(
+		"{client_ip}", getClientIP(r),
+		"{route}", hr.route,
+		"{host}", r.Host,
+		"{method}", r.Method,
+		"{path}", r.URL.Path,
+		"{scheme}", scheme(r),
+	)
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// setForwarded sets the headers describing the original request in on the outbound one. The ones sent by the
+// client are kept, and appended to, only when trusted
+func setForwarded(out *http.Request, in *http.Request, config types.Forwarded) {
+	clientIP := getClientIP(in)
+	if config.XForwarded == nil || *config.XForwarded {
+		forwardedFor, forwardedHost, forwardedProto := clientIP, in.Host, scheme(in)
+		if config.Trust {
+			if prior := in.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+				forwardedFor = strings.Join(prior, ", ") + ", " + clientIP
+			}
+			forwardedHost = valueOrDefault(in.Header.Get("X-Forwarded-Host"), forwardedHost)
+			forwardedProto = valueOrDefault(in.Header.Get("X-Forwarded-Proto"), forwardedProto)
+		}
+		out.Header.Set("X-Forwarded-For", forwardedFor)
+		out.Header.Set("X-Forwarded-Host", forwardedHost)
+		out.Header.Set("X-Forwarded-Proto", forwardedProto)
+	} else {
+		out.Header.Del("X-Forwarded-For")
+		out.Header.Del("X-Forwarded-Host")
+		out.Header.Del("X-Forwarded-Proto")
+	}
+
+	out.Header.Del("Forwarded")
+	if config.Standard {
+		// IPv6 addresses have to be quoted, along with their brackets
+		node := clientIP
+		if strings.Contains(node, ":") {
+			node = fmt.Sprintf("%q", "["+node+"]")
+		}
+		element := fmt.Sprintf("for=%v;host=%q;proto=%v", node, in.Host, scheme(in))
+		if prior := in.Header.Values("Forwarded"); config.Trust && len(prior) > 0 {
+			element = strings.Join(prior, ", ") + ", " + element
+		}
+		out.Header.Set("Forwarded", element)
+	} else if config.Trust {
+		// Kept as sent by the client
+		if prior := in.Header.Values("Forwarded"); len(prior) > 0 {
+			out.Header["Forwarded"] = prior
+		}
+	}
+}
+
+// withResponseHeaders applies the response rules and CORS policy of the route to the responses of next.
+// Preflight requests are answered by the CORS policy without reaching next
+func withResponseHeaders(next http.Handler, rules *headerRules, cors *corsPolicy) http.Handler {
+	if rules == nil && cors == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cors.preflight(w, r) {
+			return
+		}
+		next.ServeHTTP(&headerWriter{ResponseWriter: w, apply: func(header http.Header) {
+			cors.apply(header, r)
+			rules.apply(header, r)
+		}}, r)
+	})
+}
+
+// headerWriter changes the headers of a response right before they are sent, so the ones copied from the
+// target response can be changed too
+type headerWriter struct {
+	http.ResponseWriter
+	apply   func(http.Header)
+	applied bool
+}
+
+func (hw *headerWriter) WriteHeader(status int) {
+	// Informational responses are followed by the final one
+	if !hw.applied && status >= http.StatusOK {
+		hw.applied = true
+		hw.apply(hw.Header())
+	}
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack applies the rules before the connection is taken over. Upgrades never call WriteHeader, as the
+// reverse proxy writes the 101 response with these headers straight to the hijacked connection
+func (hw *headerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !hw.applied {
+		hw.applied = true
+		hw.apply(hw.Header())
+	}
+	return http.NewResponseController(hw.ResponseWriter).Hijack()
+}
+
+func (hw *headerWriter) Write(b []byte) (int, error) {
+	if !hw.applied {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (hw *headerWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
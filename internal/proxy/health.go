@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"titan/pkg/types"
+)
+
+// Health states of a route target
+const (
+	HEALTHY   = "healthy"
+	UNHEALTHY = "unhealthy"
+)
+
+// Defaults for the health checks
+const (
+	defaultHealthInterval = 2 * time.Second
+	defaultHealthTimeout  = 1 * time.Second
+)
+
+// healthChecker checks the target of a route periodically, keeping whether it is healthy so requests can wait
+// for it
+type healthChecker struct {
+	route    string
+	target   *url.URL
+	path     string
+	interval time.Duration
+	client   *http.Client
+	cancel   context.CancelFunc
+
+	mu sync.Mutex
+	// state is empty until the first check finishes
+	state   string
+	lastErr error
+	// changed is closed and replaced when the state changes, waking up the requests waiting for the target
+	changed chan struct{}
+}
+
+// newHealthChecker returns the checker of the route target, nil when checks are not configured
+func newHealthChecker(route string, target *url.URL, config types.HealthCheck, transport http.RoundTripper) *healthChecker {
+	if config.Path == "" && config.Wait == 0 {
+		return nil
+	}
+	return &healthChecker{
+		route:    route,
+		target:   target,
+		path:     config.Path,
+		interval: valueOrDefault(config.Interval, defaultHealthInterval),
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   valueOrDefault(config.Timeout, defaultHealthTimeout),
+			// A redirect is already an answer from the target
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		changed: make(chan struct{}),
+	}
+}
+
+// start checks the target right away and then on every interval, until stopped
+func (h *healthChecker) start() {
+	if h == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			h.set(h.check(ctx))
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (h *healthChecker) stop() {
+	if h != nil && h.cancel != nil {
+		h.cancel()
+	}
+}
+
+// check requests the health path of the target, or connects to it when there is none
+func (h *healthChecker) check(ctx context.Context) error {
+	if h.path == "" {
+		host := h.target.Host
+		if h.target.Port() == "" {
+			port := "80"
+			if h.target.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(h.target.Hostname(), port)
+		}
+		dialer := &net.Dialer{Timeout: h.client.Timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	checkURL := h.target.ResolveReference(&url.URL{Path: h.path})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("health check answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// set updates the state with the result of a check, logging when it changes
+func (h *healthChecker) set(err error) {
+	state := HEALTHY
+	if err != nil {
+		state = UNHEALTHY
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = err
+	if h.state == state {
+		return
+	}
+	h.state = state
+	close(h.changed)
+	h.changed = make(chan struct{})
+	if err != nil {
+		slog.Warn("upstream unhealthy", "route", h.route, "target", h.target.String(), "error", err)
+	} else {
+		slog.Info("upstream healthy", "route", h.route, "target", h.target.String())
+	}
+}
+
+// status returns the state of the target, empty when it is not checked or the first check has not finished
+func (h *healthChecker) status() string {
+	if h == nil {
+		return ""
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// wait blocks whilst the target is unhealthy, until it becomes healthy or the context is done. When done, the
+// error of the last check is returned, if any
+func (h *healthChecker) wait(ctx context.Context) error {
+	for {
+		h.mu.Lock()
+		state, changed, lastErr := h.state, h.changed, h.lastErr
+		h.mu.Unlock()
+		if state != UNHEALTHY {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if lastErr != nil {
+				return lastErr
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// waitingTransport holds the requests whilst the target is unhealthy and retries the ones failing to connect to
+// it, until it becomes healthy or the wait times out
+type waitingTransport struct {
+	next   http.RoundTripper
+	health *healthChecker
+	wait   time.Duration
+}
+
+func (t *waitingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.wait)
+	defer cancel()
+	for {
+		if err := t.health.wait(ctx); err != nil {
+			if req.Context().Err() == nil {
+				return nil, fmt.Errorf("upstream still unhealthy after waiting %v: %w", t.wait, err)
+			}
+			return nil, err
+		}
+		resp, err := t.next.RoundTrip(req)
+		// Requests with a body cannot be sent again, as it may have been consumed already
+		if err == nil || !isDialError(err) || (req.Body != nil && req.Body != http.NoBody) || ctx.Err() != nil {
+			return resp, err
+		}
+		t.health.set(err)
+	}
+}
+
+// isDialError checks if the request failed connecting to the upstream, so it never reached it
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
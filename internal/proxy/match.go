@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"titan/pkg/types"
+)
+
+// matcher holds the conditions, besides the path prefix, a request must meet to be handled by a route
+type matcher struct {
+	// host to match. When it starts with "*." any single subdomain label matches
+	host    string
+	methods []string
+	headers map[string]string
+	query   map[string]string
+}
+
+func newMatcher(config types.RouteMatch) matcher {
+	methods := make([]string, 0, len(config.Methods))
+	for _, method := range config.Methods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	return matcher{
+		host:    strings.ToLower(config.Host),
+		methods: methods,
+		headers: config.Headers,
+		query:   config.Query,
+	}
+}
+
+// matches checks if the request meets all the conditions
+func (m matcher) matches(r *http.Request) bool {
+	if m.host != "" && !matchHost(m.host, requestHost(r)) {
+		return false
+	}
+	if len(m.methods) > 0 && !slices.Contains(m.methods, r.Method) {
+		return false
+	}
+	for name, value := range m.headers {
+		values, found := r.Header[http.CanonicalHeaderKey(name)]
+		if !found || (value != "" && !slices.Contains(values, value)) {
+			return false
+		}
+	}
+	if len(m.query) > 0 {
+		query := r.URL.Query()
+		for name, value := range m.query {
+			values, found := query[name]
+			if !found || (value != "" && !slices.Contains(values, value)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// specificity ranks the matcher so, for the same path prefix, routes with more conditions are tried first
+// and an exact host is preferred over a wildcard one
+func (m matcher) specificity() int {
+	specificity := len(m.headers) + len(m.query)
+	if len(m.methods) > 0 {
+		specificity++
+	}
+	if m.host != "" {
+		specificity += 2
+		if strings.HasPrefix(m.host, "*.") {
+			specificity--
+		}
+	}
+	return specificity
+}
+
+// matchHost checks if the host matches the pattern, supporting a leading "*." wildcard for one label
+func matchHost(pattern string, host string) bool {
+	if suffix, found := strings.CutPrefix(pattern, "*"); found {
+		label, rest, ok := strings.Cut(host, ".")
+		return ok && label != "" && "."+rest == suffix
+	}
+	return pattern == host
+}
+
+// requestHost returns the lowercased host of the request without the port
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
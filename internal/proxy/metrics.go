@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UNMATCHED is the route name the requests not handled by any route are counted under
+const UNMATCHED = "-"
+
+// RESET is the status class of the connections reset without answering, like the ones of the injected faults
+const RESET = "reset"
+
+// LatencyBuckets are the upper bounds, in seconds, of the latency histogram of each route
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// RouteMetrics holds the counters of the requests handled by a route
+type RouteMetrics struct {
+	Requests int64 `json:"requests"`
+	InFlight int64 `json:"inFlight"`
+	// Errors counts the responses with a 5xx status and the connections reset without answering
+	Errors int64 `json:"errors"`
+	Bytes  int64 `json:"bytes"`
+	// Statuses counts the responses by status class, like 2xx. The connections reset are counted as RESET
+	Statuses map[string]int64 `json:"statuses"`
+	// LatencyMs is the total time spent handling the requests
+	LatencyMs float64 `json:"latencyMs"`
+	// LatencyBuckets counts the requests by latency, each position matching the bound in LatencyBuckets. The
+	// last one counts the requests slower than all of them
+	LatencyBuckets []int64 `json:"latencyBuckets"`
+	// UpstreamErrors counts the requests that failed reaching the upstream
+	UpstreamErrors int64 `json:"upstreamErrors"`
+}
+
+// MetricsSnapshot holds the counters of the proxy at a point in time
+type MetricsSnapshot struct {
+	UptimeMs    int64                   `json:"uptimeMs"`
+	Requests    int64                   `json:"requests"`
+	InFlight    int64                   `json:"inFlight"`
+	Connections int64                   `json:"connections"`
+	Routes      map[string]RouteMetrics `json:"routes"`
+}
+
+// Metrics counts the requests handled by the proxy on each route
+type Metrics struct {
+	started time.Time
+	// connections counts the client connections open
+	connections atomic.Int64
+
+	mu     sync.Mutex
+	routes map[string]*RouteMetrics
+}
+
+// NewMetrics returns empty Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{started: time.Now(), routes: map[string]*RouteMetrics{}}
+}
+
+// route returns the counters of the route, creating them if needed. The lock must be held
+func (m *Metrics) route(name string) *RouteMetrics {
+	metrics, found := m.routes[name]
+	if !found {
+		metrics = &RouteMetrics{Statuses: map[string]int64{}, LatencyBuckets: make([]int64, len(LatencyBuckets)+1)}
+		m.routes[name] = metrics
+	}
+	return metrics
+}
+
+// begin counts a request in flight on the route
+func (m *Metrics) begin(route string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.route(route).InFlight++
+}
+
+// end counts a request handled by the route
+func (m *Metrics) end(route string, status int, bytes int64, latency time.Duration, upstreamErr bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metrics := m.route(route)
+	metrics.InFlight--
+	metrics.Requests++
+	metrics.Bytes += bytes
+	metrics.LatencyMs += float64(latency) / float64(time.Millisecond)
+	bucket, _ := slices.BinarySearch(LatencyBuckets, latency.Seconds())
+	metrics.LatencyBuckets[bucket]++
+	if status == 0 {
+		// Reset without answering
+		metrics.Statuses[RESET]++
+		metrics.Errors++
+	} else {
+		metrics.Statuses[fmt.Sprintf("%dxx", status/100)]++
+		if status >= 500 {
+			metrics.Errors++
+		}
+	}
+	if upstreamErr {
+		metrics.UpstreamErrors++
+	}
+}
+
+// ConnState keeps count of the open client connections. It is meant for http.Server.ConnState. Upgraded
+// connections, like WebSockets, are no longer counted once hijacked
+func (m *Metrics) ConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		m.connections.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		m.connections.Add(-1)
+	}
+}
+
+// Snapshot returns a copy of the current counters
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := MetricsSnapshot{
+		UptimeMs:    time.Since(m.started).Milliseconds(),
+		Connections: m.connections.Load(),
+		Routes:      make(map[string]RouteMetrics, len(m.routes)),
+	}
+	for name, metrics := range m.routes {
+		route := *metrics
+		route.Statuses = make(map[string]int64, len(metrics.Statuses))
+		for class, count := range metrics.Statuses {
+			route.Statuses[class] = count
+		}
+		route.LatencyBuckets = slices.Clone(metrics.LatencyBuckets)
+		snapshot.Routes[name] = route
+		snapshot.Requests += metrics.Requests
+		snapshot.InFlight += metrics.InFlight
+	}
+	return snapshot
+}
+
+// serve handles the request with the route handler, counting it under the route name
+func (m *Metrics) serve(route string, handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	m.begin(route)
+	recorder := &responseRecorder{ResponseWriter: w}
+	defer func() {
+		status := recorder.status
+		if status == 0 && !recorder.reset {
+			status = http.StatusOK
+		}
+		entry := getAccessEntry(r)
+		m.end(route, status, recorder.bytes, time.Since(start), entry != nil && entry.upstreamErr != nil)
+	}()
+	handler.ServeHTTP(recorder, r)
+}
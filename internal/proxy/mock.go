@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// maxMockRequestBody is the maximum size of the request body available to the templates
+const maxMockRequestBody = 1 << 20
+
+// mockTemplateFuncs are the functions available to the templates of the mock responses, besides the builtin ones
+var mockTemplateFuncs = template.FuncMap{"now": time.Now}
+
+// mockRequest is the data of the templates of the mock responses
+type mockRequest struct {
+	Route   string
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   map[string]string
+	Headers map[string]string
+	Body    string
+}
+
+// mockResponse is a response of a mock route with its conditions ready to be matched
+type mockResponse struct {
+	types.MockResponse
+	matcher matcher
+}
+
+// mockHandler answers the requests of a route with the first configured response matching them
+type mockHandler struct {
+	route       string
+	stripPrefix string
+	responses   []mockResponse
+}
+
+func newMockHandler(name string, route types.Route) *mockHandler {
+	responses := make([]mockResponse, 0, len(route.Mock.Responses))
+	for _, response := range route.Mock.Responses {
+		var methods []string
+		if response.Method != "" {
+			methods = []string{response.Method}
+		}
+		responses = append(responses, mockResponse{
+			MockResponse: response,
+			matcher:      newMatcher(types.RouteMatch{Methods: methods, Query: response.Query}),
+		})
+	}
+	return &mockHandler{route: name, stripPrefix: routeStripPrefix(route), responses: responses}
+}
+
+func (h *mockHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := localPath(r.URL, h.stripPrefix)
+	if entry := getAccessEntry(r); entry != nil {
+		entry.upstream = "mock"
+	}
+
+	for _, response := range h.responses {
+		params, found := matchPathPattern(response.Path, path)
+		if !found || !response.matcher.matches(r) {
+			continue
+		}
+		if response.Latency > 0 {
+			select {
+			case <-time.After(response.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if response.ErrorRate > 0 && rand.Float64() < response.ErrorRate {
+			http.Error(w, "mock error injected", valueOrDefault(response.ErrorStatus, http.StatusInternalServerError))
+			return
+		}
+		h.respond(w, r, response, h.request(r, path, params))
+		return
+	}
+	http.Error(w, fmt.Sprintf("no mock response matches %v %v", r.Method, path), http.StatusNotFound)
+}
+
+// request collects the data of the request for the templates
+func (h *mockHandler) request(r *http.Request, path string, params map[string]string) mockRequest {
+	request := mockRequest{
+		Route:   h.route,
+		Method:  r.Method,
+		Path:    path,
+		Params:  params,
+		Query:   map[string]string{},
+		Headers: map[string]string{},
+	}
+	for name, values := range r.URL.Query() {
+		request.Query[name] = values[0]
+	}
+	for name, values := range r.Header {
+		request.Headers[name] = values[0]
+	}
+	if r.Body != nil {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxMockRequestBody))
+		request.Body = string(body)
+	}
+	return request
+}
+
+// respond renders the body of the response and sends it
+func (h *mockHandler) respond(w http.ResponseWriter, r *http.Request, response mockResponse, request mockRequest) {
+	body, contentType, err := renderMockBody(response.MockResponse, request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed rendering mock response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(valueOrDefault(response.Status, http.StatusOK))
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// renderMockBody returns the body of the response along with its content type, empty when it has to be
+// detected from the body
+func renderMockBody(response types.MockResponse, request mockRequest) ([]byte, string, error) {
+	if response.File != "" {
+		path := utils.PathWithUserHome(response.File)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		rendered, err := renderMockTemplate(string(content), request)
+		return []byte(rendered), mime.TypeByExtension(filepath.Ext(path)), err
+	}
+	switch body := response.Body.(type) {
+	case nil:
+		return nil, "", nil
+	case string:
+		rendered, err := renderMockTemplate(body, request)
+		return []byte(rendered), "", err
+	}
+	rendered, err := renderMockValue(response.Body, request)
+	if err != nil {
+		return nil, "", err
+	}
+	encoded, err := json.Marshal(rendered)
+	return encoded, "application/json", err
+}
+
+// renderMockValue renders the strings of the structured body, like the values of a map
+func renderMockValue(value any, request mockRequest) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return renderMockTemplate(value, request)
+	case map[string]any:
+		rendered := make(map[string]any, len(value))
+		for key, item := range value {
+			renderedItem, err := renderMockValue(item, request)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = renderedItem
+		}
+		return rendered, nil
+	case []any:
+		rendered := make([]any, 0, len(value))
+		for _, item := range value {
+			renderedItem, err := renderMockValue(item, request)
+			if err != nil {
+				return nil, err
+			}
+			rendered = append(rendered, renderedItem)
+		}
+		return rendered, nil
+	}
+	return value, nil
+}
+
+func renderMockTemplate(text string, request mockRequest) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New("mock").Funcs(mockTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, request); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// matchPathPattern checks if the path matches the pattern, returning the values of its ":name" segments. A
+// trailing "*" segment matches the rest of the path, and an empty pattern any path
+func matchPathPattern(pattern string, path string) (map[string]string, bool) {
+	params := map[string]string{}
+	if pattern == "" {
+		return params, true
+	}
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range patternSegments {
+		if segment == "*" && i == len(patternSegments)-1 {
+			return params, true
+		}
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+		if name, isParam := strings.CutPrefix(segment, ":"); isParam {
+			params[name] = pathSegments[i]
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, len(patternSegments) == len(pathSegments)
+}
@@ -1,140 +1,495 @@
 package proxy
 
 import (
-	"errors"
+	"crypto/tls"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"titan/internal/core"
+	"titan/internal/events"
+	"titan/internal/tasks"
+	"titan/pkg/types"
 )
 
 type Route struct {
+	Name   string
 	Source string
-	Target *url.URL
+	// AccessLog indicates if the requests handled by the route are logged
+	AccessLog bool
+	// matcher holds the conditions, besides the source, a request must meet
+	matcher matcher
+	// handler proxies the requests to the targets, balancing them when there are several. It is built once and
+	// reused for every request
+	handler http.Handler
+	// backends are the targets of the route, none when it answers the requests itself
+	backends []*backend
+	// local describes what answers the requests when there are no targets, like the directory served
+	local string
+	// faults are the configured faults of the route
+	faults []types.Fault
+	// task is the task serving the targets, shown on the error page
+	task string
 }
 
 // getClientIP extracts the client's IP address from the request
 func getClientIP(r *http.Request) string {
-	// Get IP address from the remote address (in case there is no X-Forwarded-For)
 	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 	return ip
 }
 
-func createReverseProxy(target *url.URL, source string) http.HandlerFunc {
-	proxy := httputil.NewSingleHostReverseProxy(target)
+func createReverseProxy(name string, route types.Route, target *url.URL, rewriter *pathRewriter, transport http.RoundTripper, errorHandler func(http.ResponseWriter, *http.Request, error)) http.Handler {
+	proxy := &httputil.ReverseProxy{Transport: transport, FlushInterval: route.Streaming.FlushInterval, ErrorHandler: errorHandler}
 	proxy.ModifyResponse = func(resp *http.Response) error {
 		resp.Header.Del("X-Powered-By")
 		return nil
 	}
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-
-		prefix := strings.TrimRight(source, "/")
-		targetBase := strings.TrimRight(target.Path, "/")
-
-		// TODO - the ReplaceAll call works for now but I'd like to improve it as it feels a bit clunky :(
-		//   The problem is that after calling "originalDirector(req)" /identity appears twice in the req.Path
-		// Prevent double path segment
-		suffix := strings.ReplaceAll(req.URL.Path, prefix, "")
-		// suffix := strings.TrimPrefix(req.URL.Path, prefix)
-		// suffix = strings.TrimPrefix(suffix, prefix)
-
-		if strings.HasPrefix(suffix, "/") {
-			suffix = suffix[1:]
+	requestHeaders := newHeaderRules(name, route.Headers.Request)
+	// Rewrite is used instead of Director so the forwarded headers are fully ours. The ReverseProxy removes the
+	// X-Forwarded-* ones of the client before calling it and does not append to them afterwards
+	proxy.Rewrite = func(pr *httputil.ProxyRequest) {
+		req := pr.Out
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		rewriter.rewrite(req.URL)
+		req.URL.RawQuery = joinQuery(target.RawQuery, req.URL.RawQuery)
+		if _, ok := req.Header["User-Agent"]; !ok {
+			// Explicitly disable the default User-Agent so it is not added
+			req.Header.Set("User-Agent", "")
 		}
 
-		if targetBase != "" {
-			req.URL.Path = "/" + strings.TrimRight(targetBase, "/") + "/" + suffix
-		} else {
-			req.URL.Path = "/" + suffix
+		if entry := getAccessEntry(req); entry != nil {
+			entry.upstream = req.URL.String()
 		}
 
-		req.URL.Path = strings.ReplaceAll(req.URL.Path, "//", "/")
+		setForwarded(req, pr.In, route.Forwarded)
+		req.Host = target.Host
+		requestHeaders.apply(req.Header, pr.In)
+	}
 
-		// Set the "X-Forwarded-Host" header to the original host
-		req.Header.Set("X-Forwarded-Host", req.Host)
-		// Keep the original client IP in X-Forwarded-For
-		clientIP := getClientIP(req)
-		if prior, ok := req.Header["X-Forwarded-For"]; ok {
-			clientIP = prior[0] + ", " + clientIP
-		}
-		req.Header.Set("X-Forwarded-For", clientIP)
+	// Upgrade requests, like WebSockets, are proxied by the ReverseProxy unless disabled for the route
+	if route.Streaming.WebSocket != nil && !*route.Streaming.WebSocket {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isUpgrade(r) {
+				http.Error(w, "upgrade requests are not allowed on this route", http.StatusBadRequest)
+				return
+			}
+			proxy.ServeHTTP(w, r)
+		})
+	}
+	return proxy
+}
 
-		req.Host = target.Host
+// isUpgrade checks if the request asks to switch protocols, as WebSockets do
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header["Connection"] {
+		for token := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-		// Add X-Forwarded-Proto to indicate if the original request was HTTP or HTTPS
-		if req.TLS != nil {
-			req.Header.Set("X-Forwarded-Proto", "https")
-		} else {
-			req.Header.Set("X-Forwarded-Proto", "http")
+// errorHandler returns the handler of the requests the route fails to proxy to the backend. It shows an error
+// page with the state and latest output of the task serving the route
+func (p *Proxy) errorHandler(route *Route, backend *backend) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if entry := getAccessEntry(r); entry != nil {
+			entry.upstreamErr = err
 		}
+		slog.Error("failed proxying request", "route", route.Name, "upstream", r.URL.String(), "error", err)
+		newErrorPage(route, backend, err, p.tasks).write(w, r)
 	}
-	return proxy.ServeHTTP
 }
 
-func buildRoutes(proxyConfig map[string]struct {
-	Source string `yaml:"source"`
-	Target string `yaml:"target"`
-}) ([]Route, error) {
-	routes := make([]Route, 0, len(proxyConfig))
-	for _, cfg := range proxyConfig {
-		targetURL, err := url.Parse(cfg.Target)
-		if err != nil {
-			return nil, fmt.Errorf("invalid target URL %q: %w", cfg.Target, err)
+func (p *Proxy) buildRoutes(serverConfig types.Server) ([]Route, error) {
+	routes := make([]Route, 0, len(serverConfig.Routes))
+	for name, cfg := range serverConfig.Routes {
+		routeAccessLog := serverConfig.AccessLog.Enabled
+		if cfg.AccessLog != nil {
+			routeAccessLog = *cfg.AccessLog
 		}
-		routes = append(routes, Route{
-			Source: cfg.Source,
-			Target: targetURL,
-		})
+		route := &Route{
+			Name:      name,
+			Source:    cfg.Source,
+			AccessLog: routeAccessLog,
+			matcher:   newMatcher(cfg.Match),
+			task:      cfg.Task,
+			faults:    cfg.Faults,
+		}
+		var handler http.Handler
+		switch {
+		case cfg.Static != nil:
+			static := newStaticHandler(cfg)
+			handler, route.local = static, static.dir
+		case cfg.Mock != nil:
+			mock := newMockHandler(name, cfg)
+			handler, route.local = mock, "mock"
+		case cfg.Target != "" || len(cfg.Targets) > 0:
+			proxy, err := p.buildBackends(route, cfg, serverConfig)
+			if err != nil {
+				return nil, err
+			}
+			handler = proxy
+		}
+		// Recorded before the response rules are applied, so they apply again when replayed. The replayed
+		// responses are not recorded again
+		if cfg.Record != nil && handler != nil {
+			handler = newRecorder(name, cfg.Record).middleware(handler)
+		}
+		// The requests without a recorded response are handled as usual
+		if cfg.Replay != nil {
+			if handler == nil {
+				route.local = "replay"
+			}
+			handler = newReplayHandler(name, cfg.Replay, handler)
+		}
+		// Injected within the response rules, so the failures get the CORS headers the clients expect
+		faults := newFaultInjector(name, cfg, p.routeFaults, handler)
+		route.handler = withResponseHeaders(faults, newHeaderRules(name, cfg.Headers.Response), newCORSPolicy(cfg.CORS))
+		routes = append(routes, *route)
 	}
-	// Sort by descending Source length to ensure longest match wins
+	// Sort by descending Source length to ensure longest match wins. For the same length, the routes with
+	// more conditions are tried first
 	sort.Slice(routes, func(i, j int) bool {
-		return len(routes[i].Source) > len(routes[j].Source)
+		if len(routes[i].Source) != len(routes[j].Source) {
+			return len(routes[i].Source) > len(routes[j].Source)
+		}
+		if routes[i].matcher.specificity() != routes[j].matcher.specificity() {
+			return routes[i].matcher.specificity() > routes[j].matcher.specificity()
+		}
+		return routes[i].Name < routes[j].Name
 	})
 	return routes, nil
 }
 
-func StartProxy(errorChannel chan error, container *core.Container) {
-	serverConfig := container.ConfigData.Config.Server
-	routes, err := buildRoutes(serverConfig.Routes)
+// buildBackends creates a reverse proxy for each target of the route, returning the handler of the route
+// requests. Several targets are balanced
+func (p *Proxy) buildBackends(route *Route, cfg types.Route, serverConfig types.Server) (http.Handler, error) {
+	name := route.Name
+	targets := routeTargets(cfg)
+	var lb *balancer
+	if len(targets) > 1 {
+		lb = newBalancer(name, nil, cfg.Balance)
+	}
+	for _, target := range targets {
+		targetURL, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("route [%v]: invalid target URL %q: %w", name, target, err)
+		}
+		rewriter, err := newPathRewriter(cfg, targetURL)
+		if err != nil {
+			return nil, fmt.Errorf("route [%v]: %w", name, err)
+		}
+		backend := newBackend(targetURL)
+		dedicated := routeTransport(p.transport, serverConfig.Transport, cfg)
+		if dedicated != p.transport {
+			backend.transport = dedicated
+		}
+		var transport http.RoundTripper = dedicated
+		backend.health = newHealthChecker(name, targetURL, cfg.Health, transport)
+		if cfg.Health.Wait > 0 {
+			transport = &waitingTransport{next: transport, health: backend.health, wait: cfg.Health.Wait}
+		}
+		if lb != nil {
+			transport = &observedTransport{next: transport, balancer: lb, backend: backend}
+		}
+		backend.handler = createReverseProxy(name, cfg, targetURL, rewriter, transport, p.errorHandler(route, backend))
+		route.backends = append(route.backends, backend)
+	}
+	if lb != nil {
+		lb.backends = route.backends
+		return lb, nil
+	}
+	return route.backends[0].handler, nil
+}
+
+// matchRoute returns the route handling the request, if any. Disabled routes are skipped
+func matchRoute(routes []Route, r *http.Request, disabled func(name string) bool) *Route {
+	for i := range routes {
+		if disabled(routes[i].Name) {
+			continue
+		}
+		if strings.HasPrefix(r.URL.Path, routes[i].Source) && routes[i].matcher.matches(r) {
+			return &routes[i]
+		}
+	}
+	return nil
+}
+
+// Proxy routes the requests to the upstreams. Its routes can be replaced while it is running
+type Proxy struct {
+	// transport holds the connections to the upstreams, shared by all the routes unless they override the timeouts
+	transport *http.Transport
+	routes    atomic.Pointer[[]Route]
+	metrics   *Metrics
+	// tasks run the targets of the routes, shown on the error pages
+	tasks *tasks.Manager
+
+	mu sync.RWMutex
+	// disabled holds the names of the routes disabled while running. They are kept disabled across reloads
+	disabled map[string]bool
+	// faults holds the faults of the routes set while running, replacing the configured ones. They are kept
+	// across reloads
+	faults map[string][]types.Fault
+}
+
+// RouteInfo describes a route of the proxy
+type RouteInfo struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	// Target holds the URL of the target, the ones of all of them separated by commas, the directory served,
+	// "mock" or "replay"
+	Target    string `json:"target"`
+	AccessLog bool   `json:"accessLog"`
+	Disabled  bool   `json:"disabled"`
+	// Health is the state of the target, empty when it is not checked. A route with several targets is healthy
+	// when any of them is
+	Health string `json:"health,omitempty"`
+	// Targets describes each target when the route balances across several of them
+	Targets []TargetInfo `json:"targets,omitempty"`
+}
+
+// TargetInfo describes a target of a route balanced across several of them
+type TargetInfo struct {
+	URL    string `json:"url"`
+	Health string `json:"health,omitempty"`
+	// Ejected indicates the target is left out for failing
+	Ejected bool `json:"ejected"`
+	// Active counts the requests in flight to the target
+	Active int64 `json:"active"`
+}
+
+// Routes returns the current routes, in the order they are matched
+func (p *Proxy) Routes() []RouteInfo {
+	routes := *p.routes.Load()
+	infos := make([]RouteInfo, 0, len(routes))
+	now := time.Now()
+	for _, route := range routes {
+		info := RouteInfo{
+			Name:      route.Name,
+			Source:    route.Source,
+			AccessLog: route.AccessLog,
+			Disabled:  p.isDisabled(route.Name),
+		}
+		urls := make([]string, 0, len(route.backends))
+		for _, backend := range route.backends {
+			urls = append(urls, backend.target.String())
+			health := backend.health.status()
+			if health == HEALTHY || info.Health == "" {
+				info.Health = health
+			}
+			if len(route.backends) > 1 {
+				info.Targets = append(info.Targets, TargetInfo{
+					URL:     backend.target.String(),
+					Health:  health,
+					Ejected: backend.ejected(now),
+					Active:  backend.active.Load(),
+				})
+			}
+		}
+		info.Target = strings.Join(urls, ", ")
+		if route.local != "" {
+			info.Target = route.local
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// SetRouteEnabled enables or disables the route. Requests matching a disabled route are handled by the next
+// matching one, if any
+func (p *Proxy) SetRouteEnabled(name string, enabled bool) error {
+	if !slices.ContainsFunc(*p.routes.Load(), func(route Route) bool { return route.Name == name }) {
+		return fmt.Errorf("route [%v] not found", name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if enabled {
+		delete(p.disabled, name)
+	} else {
+		p.disabled[name] = true
+	}
+	return nil
+}
+
+func (p *Proxy) isDisabled(name string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.disabled[name]
+}
+
+// Faults returns the faults injected into the requests of the route, and whether they were set while running
+func (p *Proxy) Faults(name string) ([]types.Fault, bool, error) {
+	index := slices.IndexFunc(*p.routes.Load(), func(route Route) bool { return route.Name == name })
+	if index < 0 {
+		return nil, false, fmt.Errorf("route [%v] not found", name)
+	}
+	if faults, found := p.routeFaults(name); found {
+		return faults, true, nil
+	}
+	return (*p.routes.Load())[index].faults, false, nil
+}
+
+// SetFaults replaces the faults of the route until they are reset. An empty list stops injecting any
+func (p *Proxy) SetFaults(name string, faults []types.Fault) error {
+	if !slices.ContainsFunc(*p.routes.Load(), func(route Route) bool { return route.Name == name }) {
+		return fmt.Errorf("route [%v] not found", name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[name] = slices.Clone(faults)
+	return nil
+}
+
+// ResetFaults goes back to the configured faults of the route
+func (p *Proxy) ResetFaults(name string) error {
+	if !slices.ContainsFunc(*p.routes.Load(), func(route Route) bool { return route.Name == name }) {
+		return fmt.Errorf("route [%v] not found", name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.faults, name)
+	return nil
+}
+
+func (p *Proxy) routeFaults(name string) ([]types.Fault, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	faults, found := p.faults[name]
+	return faults, found
+}
+
+// Metrics returns the counters of the requests handled by the proxy
+func (p *Proxy) Metrics() *Metrics {
+	return p.metrics
+}
+
+// SetRoutes builds the routes of the server configuration and swaps them with the current ones. Requests in
+// flight finish with the routes they matched, whilst new ones use the new routes. The health checks of the
+// previous routes are stopped, and the idle connections of their dedicated transports closed
+func (p *Proxy) SetRoutes(serverConfig types.Server) error {
+	routes, err := p.buildRoutes(serverConfig)
 	if err != nil {
-		errorChannel <- err
+		return err
 	}
+	for _, route := range routes {
+		for _, backend := range route.backends {
+			backend.health.start()
+		}
+	}
+	if previous := p.routes.Swap(&routes); previous != nil {
+		for _, route := range *previous {
+			for _, backend := range route.backends {
+				backend.health.stop()
+				if backend.transport != nil {
+					backend.transport.CloseIdleConnections()
+				}
+			}
+		}
+	}
+	return nil
+}
 
+// handler returns the handler passing the requests to the route matching them. The unmatched requests are
+// logged when logUnmatched is set
+func (p *Proxy) handler(logUnmatched bool) http.Handler {
 	httpMux := http.NewServeMux()
 	httpMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		for _, route := range routes {
-			if strings.HasPrefix(path, route.Source) {
-				createReverseProxy(route.Target, route.Source)(w, r)
-				return
+		entry := getAccessEntry(r)
+		if route := matchRoute(*p.routes.Load(), r, p.isDisabled); route != nil {
+			if entry != nil {
+				entry.route = route.Name
+				entry.skip = !route.AccessLog
 			}
+			p.metrics.serve(route.Name, route.handler, w, r)
+			return
+		}
+		if entry != nil {
+			entry.skip = !logUnmatched
 		}
-		http.NotFound(w, r)
+		p.metrics.serve(UNMATCHED, http.HandlerFunc(http.NotFound), w, r)
 	})
+	return httpMux
+}
+
+// StartProxy starts the HTTP and HTTPS servers. The state of the tasks is shown on the error pages of the
+// routes they serve. Errors setting up the proxy are returned, whilst errors from the running servers are sent
+// to the error channel
+func StartProxy(errorChannel chan error, container *core.Container, manager *tasks.Manager) (*Proxy, error) {
+	serverConfig := container.ConfigData.Config.Server
+	proxy := &Proxy{
+		transport: newTransport(serverConfig.Transport, 0),
+		metrics:   NewMetrics(),
+		tasks:     manager,
+		disabled:  map[string]bool{},
+		faults:    map[string][]types.Fault{},
+	}
+	if err := proxy.SetRoutes(serverConfig); err != nil {
+		return nil, err
+	}
+
+	// Requests are skipped by the access log unless it is enabled for their route. Routes can be reloaded, so
+	// the middleware is always set up
+	accessLog, err := NewAccessLog(serverConfig.AccessLog, container.Logger)
+	if err != nil {
+		return nil, err
+	}
+	handler := accessLog.Middleware(proxy.handler(serverConfig.AccessLog.Enabled))
 
-	go func() {
-		httpAddr := fmt.Sprintf("%s:%d", serverConfig.Host, serverConfig.Port)
-		container.Logger.Info("starting HTTP server", "address", httpAddr)
-		if err := http.ListenAndServe(httpAddr, httpMux); err != nil {
-			errorChannel <- err
+	// Errors from the servers, like TLS handshake failures, go through the configured logger
+	errorLog := slog.NewLogLogger(container.Logger.Handler(), slog.LevelError)
+
+	mode, err := sslMode(serverConfig.SSL)
+	if err != nil {
+		return nil, err
+	}
+	var certificates *tls.Config
+	if mode != HTTP_ONLY {
+		if certificates, err = tlsConfig(serverConfig.SSL, serverConfig.Host, container.ConfigData.StateDir()); err != nil {
+			return nil, err
 		}
-	}()
+	}
 
-	go func() {
-		if serverConfig.SSL.Cert != "" && serverConfig.SSL.Key != "" {
+	if mode != HTTPS_ONLY {
+		httpHandler := handler
+		if mode == REDIRECT {
+			httpHandler = redirectToHTTPS(serverConfig.SSL.Port)
+		}
+		go func() {
+			httpAddr := fmt.Sprintf("%s:%d", serverConfig.Host, serverConfig.Port)
+			container.Logger.Info("starting HTTP server", "address", httpAddr, "mode", mode)
+			container.Events.Emit(events.Event{Type: events.SERVER_STARTED, State: "http", Data: httpAddr})
+			server := &http.Server{Addr: httpAddr, Handler: httpHandler, ErrorLog: errorLog, ConnState: proxy.metrics.ConnState}
+			if err := server.ListenAndServe(); err != nil {
+				errorChannel <- err
+			}
+		}()
+	}
+
+	if mode != HTTP_ONLY {
+		go func() {
 			httpsAddr := fmt.Sprintf("%s:%d", serverConfig.Host, serverConfig.SSL.Port)
-			container.Logger.Info("starting HTTPS server", "address", httpsAddr)
-			if err := http.ListenAndServeTLS(httpsAddr, serverConfig.SSL.Cert, serverConfig.SSL.Key, httpMux); err != nil {
+			container.Logger.Info("starting HTTPS server", "address", httpsAddr, "mode", mode)
+			container.Events.Emit(events.Event{Type: events.SERVER_STARTED, State: "https", Data: httpsAddr})
+			server := &http.Server{Addr: httpsAddr, Handler: handler, ErrorLog: errorLog, TLSConfig: certificates, ConnState: proxy.metrics.ConnState}
+			if err := server.ListenAndServeTLS(serverConfig.SSL.Cert, serverConfig.SSL.Key); err != nil {
 				errorChannel <- err
 			}
-		} else {
-			errorChannel <- errors.New("TLS configuration missing. Please add valid value and try again")
-		}
-	}()
+		}()
+	}
+	return proxy, nil
 }
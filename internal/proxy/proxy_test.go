@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"titan/pkg/types"
+)
+
+func newTestProxy() *Proxy {
+	return &Proxy{
+		transport: newTransport(types.Transport{}, 0),
+		metrics:   NewMetrics(),
+		disabled:  map[string]bool{},
+		faults:    map[string][]types.Fault{},
+	}
+}
+
+// BenchmarkProxy compares building the reverse proxy of the route on every request, as it used to be done,
+// with reusing the one built along with the route
+func BenchmarkProxy(b *testing.B) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	proxy := newTestProxy()
+	config := types.Route{
+		Source:  "/api",
+		Target:  upstream.URL + "/svc",
+		Rewrite: []types.RewriteRule{{Match: "^/v1/(.*)$", Replace: "/v2/$1"}},
+	}
+	routes, err := proxy.buildRoutes(types.Server{Routes: map[string]types.Route{"api": config}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	route := &routes[0]
+	target, err := url.Parse(config.Target)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	serve := func(b *testing.B, handler func() http.Handler) {
+		b.ReportAllocs()
+		for b.Loop() {
+			recorder := httptest.NewRecorder()
+			handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+			if recorder.Code != http.StatusOK {
+				b.Fatalf("unexpected status %d", recorder.Code)
+			}
+		}
+	}
+	b.Run("per request", func(b *testing.B) {
+		serve(b, func() http.Handler {
+			rewriter, err := newPathRewriter(config, target)
+			if err != nil {
+				b.Fatal(err)
+			}
+			backend := newBackend(target)
+			return createReverseProxy(route.Name, config, target, rewriter, proxy.transport, proxy.errorHandler(route, backend))
+		})
+	})
+	b.Run("prebuilt", func(b *testing.B) {
+		serve(b, func() http.Handler {
+			return route.handler
+		})
+	})
+}
+
+func TestSetRoutesClosesDedicatedTransports(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			select {
+			case closed <- struct{}{}:
+			default:
+			}
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	proxy := newTestProxy()
+	config := types.Server{Routes: map[string]types.Route{
+		"api": {Source: "/api", Target: upstream.URL, ResponseTimeout: 5 * time.Second},
+	}}
+	if err := proxy.SetRoutes(config); err != nil {
+		t.Fatal(err)
+	}
+	previous := (*proxy.routes.Load())[0].backends[0]
+	if previous.transport == nil || previous.transport == proxy.transport {
+		t.Fatal("the route should have a dedicated transport")
+	}
+	recorder := httptest.NewRecorder()
+	previous.handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", recorder.Code)
+	}
+
+	if err := proxy.SetRoutes(config); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle connection of the previous transport was not closed")
+	}
+}
+
+func TestBalancerEjectsTargetsAnsweringWithGatewayErrors(t *testing.T) {
+	for _, test := range []struct {
+		status  int
+		ejected bool
+	}{
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+		{http.StatusInternalServerError, false},
+	} {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer failing.Close()
+			healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "ok")
+			}))
+			defer healthy.Close()
+
+			proxy := newTestProxy()
+			routes, err := proxy.buildRoutes(types.Server{Routes: map[string]types.Route{
+				"api": {Source: "/api", Targets: []string{failing.URL, healthy.URL}, Balance: types.Balance{EjectAfter: 2}},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			route := routes[0]
+			for range 4 {
+				route.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+			}
+			if ejected := route.backends[0].ejected(time.Now()); ejected != test.ejected {
+				t.Fatalf("target ejected: %v, want %v", ejected, test.ejected)
+			}
+			if !test.ejected {
+				return
+			}
+			for range 4 {
+				recorder := httptest.NewRecorder()
+				route.handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api", nil))
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("request sent to the ejected target, got status %d", recorder.Code)
+				}
+			}
+		})
+	}
+}
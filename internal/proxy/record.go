@@ -0,0 +1,448 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"titan/internal/utils"
+	"titan/pkg/types"
+	"unicode/utf8"
+)
+
+// Formats of the recording files
+const (
+	JSONL = "jsonl"
+	HAR   = "har"
+)
+
+// REDACTED replaces the values of the redacted headers
+const REDACTED = "[REDACTED]"
+
+// defaultMaxBodySize is the maximum number of bytes recorded of each body when none is configured
+const defaultMaxBodySize = 1 << 20
+
+// harFlushInterval is how long the HAR entries are kept in memory before the file is written
+const harFlushInterval = time.Second
+
+// defaultRedact are the headers redacted when none are configured
+var defaultRedact = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// recordLocks serialises the writes to each recording file, also across the routes sharing it and reloads
+var recordLocks sync.Map
+
+// harFiles holds the HAR files being recorded by path, shared across the routes recording to them and reloads
+var harFiles sync.Map
+
+// harLog is the root of a HAR file
+type harLog struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// harEntry is a recorded exchange, as a HAR entry. Each line of the JSON lines files is one of them
+type harEntry struct {
+	Route           string      `json:"_route,omitempty"`
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harPair   `json:"cookies"`
+	Headers     []harPair   `json:"headers"`
+	QueryString []harPair   `json:"queryString"`
+	PostData    *harContent `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harPair  `json:"cookies"`
+	Headers     []harPair  `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int64      `json:"bodySize"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harContent holds a body. Binary ones are base64 encoded. Bodies longer than the maximum recorded are cut,
+// which is flagged on the custom _truncated field
+type harContent struct {
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text"`
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// body returns the decoded body
+func (c *harContent) body() ([]byte, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(c.Text)
+	}
+	return []byte(c.Text), nil
+}
+
+// truncated indicates if the body was cut when recorded. Recordings without the flag are checked against the
+// size of the whole body
+func (c *harContent) truncated() bool {
+	if c == nil {
+		return false
+	}
+	if c.Truncated {
+		return true
+	}
+	body, err := c.body()
+	return err == nil && int64(len(body)) < c.Size
+}
+
+func newHARContent(body []byte, size int64, mimeType string) harContent {
+	content := harContent{Size: size, MimeType: mimeType, Text: string(body), Truncated: int64(len(body)) < size}
+	if !utf8.Valid(body) {
+		content.Text, content.Encoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return content
+}
+
+// recorder saves the requests and responses of a route to a file
+type recorder struct {
+	route       string
+	path        string
+	format      string
+	redact      []string
+	maxBodySize int64
+}
+
+func newRecorder(route string, config *types.Record) *recorder {
+	redact := config.Redact
+	if len(redact) == 0 {
+		redact = defaultRedact
+	}
+	canonical := make([]string, 0, len(redact))
+	for _, name := range redact {
+		canonical = append(canonical, http.CanonicalHeaderKey(name))
+	}
+	return &recorder{
+		route:       route,
+		path:        utils.PathWithUserHome(config.File),
+		format:      valueOrDefault(config.Format, JSONL),
+		redact:      canonical,
+		maxBodySize: valueOrDefault(config.MaxBodySize, defaultMaxBodySize),
+	}
+}
+
+// middleware records the exchanges handled by next
+func (rec *recorder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestBody := &cappedBuffer{limit: rec.maxBodySize}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, requestBody), r.Body}
+		}
+		// The request is kept as received, as the handler may change it
+		received := r.Clone(r.Context())
+		writer := &recordingWriter{ResponseWriter: w, body: cappedBuffer{limit: rec.maxBodySize}}
+		next.ServeHTTP(writer, r)
+
+		entry := rec.entry(received, requestBody, writer, start)
+		if err := rec.write(entry); err != nil {
+			slog.Error("failed recording request", "route", rec.route, "file", rec.path, "error", err)
+		}
+	})
+}
+
+func (rec *recorder) entry(r *http.Request, requestBody *cappedBuffer, writer *recordingWriter, start time.Time) harEntry {
+	elapsed := float64(time.Since(start)) / float64(time.Millisecond)
+	status := writer.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	requestURL := *r.URL
+	requestURL.Scheme, requestURL.Host = scheme(r), r.Host
+
+	entry := harEntry{
+		Route:           rec.route,
+		StartedDateTime: start,
+		Time:            elapsed,
+		Request: harRequest{
+			Method:      r.Method,
+			URL:         requestURL.String(),
+			HTTPVersion: r.Proto,
+			Cookies:     []harPair{},
+			Headers:     rec.headers(r.Header),
+			QueryString: []harPair{},
+			HeadersSize: -1,
+			BodySize:    requestBody.size,
+		},
+		Response: harResponse{
+			Status:      status,
+			StatusText:  http.StatusText(status),
+			HTTPVersion: r.Proto,
+			Cookies:     []harPair{},
+			Headers:     rec.headers(writer.Header()),
+			Content:     newHARContent(writer.body.Bytes(), writer.body.size, writer.Header().Get("Content-Type")),
+			RedirectURL: writer.Header().Get("Location"),
+			HeadersSize: -1,
+			BodySize:    writer.body.size,
+		},
+		Timings: harTimings{Send: 0, Wait: elapsed, Receive: 0},
+	}
+	for name, values := range r.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harPair{Name: name, Value: value})
+		}
+	}
+	if requestBody.size > 0 {
+		content := newHARContent(requestBody.Bytes(), requestBody.size, r.Header.Get("Content-Type"))
+		entry.Request.PostData = &content
+	}
+	return entry
+}
+
+// headers returns the headers sorted by name, redacting the configured ones
+func (rec *recorder) headers(header http.Header) []harPair {
+	pairs := []harPair{}
+	for name, values := range header {
+		for _, value := range values {
+			if slices.Contains(rec.redact, name) {
+				value = REDACTED
+			}
+			pairs = append(pairs, harPair{Name: name, Value: value})
+		}
+	}
+	slices.SortStableFunc(pairs, func(a, b harPair) int {
+		if a.Name < b.Name {
+			return -1
+		}
+		if a.Name > b.Name {
+			return 1
+		}
+		return 0
+	})
+	return pairs
+}
+
+// write appends the entry to the file. HAR files hold a single document, so their entries are kept in memory
+// and the file is written at most once per flush interval
+func (rec *recorder) write(entry harEntry) error {
+	if rec.format == HAR {
+		file, _ := harFiles.LoadOrStore(rec.path, &harFile{path: rec.path})
+		return file.(*harFile).add(entry)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	lock, _ := recordLocks.LoadOrStore(rec.path, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	if err := os.MkdirAll(filepath.Dir(rec.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rec.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// harFile is a HAR file being recorded. The entries recorded before are read once, then the whole document is
+// written shortly after the entries are added
+type harFile struct {
+	path string
+
+	mu      sync.Mutex
+	loaded  bool
+	entries []harEntry
+	// pending is set while there are entries not written yet
+	pending *time.Timer
+}
+
+func (f *harFile) add(entry harEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.loaded {
+		entries, err := readRecording(f.path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		f.entries, f.loaded = entries, true
+	}
+	f.entries = append(f.entries, entry)
+	if f.pending == nil {
+		f.pending = time.AfterFunc(harFlushInterval, func() {
+			if err := f.flush(); err != nil {
+				slog.Error("failed recording requests", "file", f.path, "error", err)
+			}
+		})
+	}
+	return nil
+}
+
+// flush writes the entries not written yet, if any
+func (f *harFile) flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pending == nil {
+		return nil
+	}
+	f.pending.Stop()
+	f.pending = nil
+
+	var har harLog
+	har.Log.Version = "1.2"
+	har.Log.Creator = harCreator{Name: "titan", Version: "1"}
+	har.Log.Entries = f.entries
+	content, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Serialised with the replays reading the file
+	lock, _ := recordLocks.LoadOrStore(f.path, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	// Written to a temporary file first, so the recording is never left half written
+	temp := f.path + ".tmp"
+	if err := os.WriteFile(temp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, f.path)
+}
+
+// FlushRecordings writes the requests recorded to HAR files not written yet. Called when shutting down
+func (p *Proxy) FlushRecordings() error {
+	var errs []error
+	harFiles.Range(func(_, file any) bool {
+		if err := file.(*harFile).flush(); err != nil {
+			errs = append(errs, err)
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// readRecording returns the entries of a recording file, either a HAR document or JSON lines
+func readRecording(path string) ([]harEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	var har harLog
+	if err := json.Unmarshal(trimmed, &har); err == nil && har.Log.Version != "" {
+		return har.Log.Entries, nil
+	}
+
+	var entries []harEntry
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry harEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid entry on line %d of %v: %w", line, path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// cappedBuffer keeps up to limit bytes written to it, counting all of them
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int64
+	size  int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	if room := b.limit - int64(b.Len()); room > 0 {
+		b.Buffer.Write(p[:min(int64(len(p)), room)])
+	}
+	return len(p), nil
+}
+
+// recordingWriter keeps the status and body of a response whilst sending it
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   cappedBuffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 && status >= http.StatusOK {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.body.Write(b[:n])
+	return n, err
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
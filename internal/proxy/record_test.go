@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"titan/pkg/types"
+)
+
+func TestRecord(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		fmt.Fprintf(w, "hello %v", r.URL.Path)
+	})
+
+	for _, format := range []string{JSONL, HAR} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "recordings", "api."+format)
+			// Recorded before, by a previous run
+			previous := newRecorder("api", &types.Record{File: path, Format: format})
+			previous.middleware(upstream).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/previous", nil))
+			if err := newTestProxy().FlushRecordings(); err != nil {
+				t.Fatal(err)
+			}
+			harFiles.Delete(path)
+
+			handler := newRecorder("api", &types.Record{File: path, Format: format}).middleware(upstream)
+			var wg sync.WaitGroup
+			for i := range 50 {
+				wg.Go(func() {
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d", i), nil))
+				})
+			}
+			wg.Wait()
+			if err := newTestProxy().FlushRecordings(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := readRecording(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 51 {
+				t.Fatalf("recorded %d entries", len(entries))
+			}
+			if got := entries[0].Request.URL; got != "http://example.com/previous" {
+				t.Errorf("first entry is %q", got)
+			}
+			for _, entry := range entries {
+				if !strings.HasPrefix(entry.Response.Content.Text, "hello ") {
+					t.Errorf("recorded body %q", entry.Response.Content.Text)
+				}
+				for _, header := range entry.Response.Headers {
+					if header.Name == "Set-Cookie" && header.Value != REDACTED {
+						t.Errorf("recorded cookie %q", header.Value)
+					}
+				}
+			}
+			if _, err := os.Stat(path + ".tmp"); err == nil {
+				t.Error("temporary file left behind")
+			}
+		})
+	}
+}
+
+func BenchmarkRecordHAR(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "api.har")
+	defer harFiles.Delete(path)
+	handler := newRecorder("api", &types.Record{File: path, Format: HAR}).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	for b.Loop() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	}
+	if err := newTestProxy().FlushRecordings(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func TestReplaySkipsTruncatedResponses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.jsonl")
+	recorder := newRecorder("api", &types.Record{File: path, MaxBodySize: 5}).middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/long" {
+			io.WriteString(w, "hello world")
+			return
+		}
+		io.WriteString(w, "hi")
+	}))
+	for _, requestPath := range []string{"/short", "/long"} {
+		recorder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, requestPath, nil))
+	}
+
+	entries, err := readRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Response.Content.Truncated || !entries[1].Response.Content.Truncated {
+		t.Fatalf("unexpected truncated flags on %+v", entries)
+	}
+	// Recorded before the flag was added
+	legacy := harContent{Size: 11, MimeType: "text/plain", Text: "hello"}
+	if !legacy.truncated() {
+		t.Error("body shorter than its size not reported as truncated")
+	}
+
+	replay := newReplayHandler("api", &types.Replay{File: path}, nil)
+	for requestPath, want := range map[string]int{"/short": http.StatusOK, "/long": http.StatusNotFound} {
+		response := httptest.NewRecorder()
+		replay.ServeHTTP(response, httptest.NewRequest(http.MethodGet, requestPath, nil))
+		if response.Code != want {
+			t.Errorf("%v replayed with status %d, want %d", requestPath, response.Code, want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// Parts of the requests compared with the recorded ones
+const (
+	MATCH_METHOD = "method"
+	MATCH_PATH   = "path"
+	MATCH_QUERY  = "query"
+	MATCH_BODY   = "body"
+)
+
+// defaultReplayMatch are the parts compared when none are configured
+var defaultReplayMatch = []string{MATCH_METHOD, MATCH_PATH, MATCH_QUERY}
+
+// hopHeaders are the headers of the recorded responses that only applied to their connection
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length",
+}
+
+// replayHandler answers the requests of a route with the responses recorded on a file. The requests without a
+// recorded response are handled by fallback, or not found when there is none
+type replayHandler struct {
+	route        string
+	path         string
+	match        []string
+	matchHeaders []string
+	fallback     http.Handler
+
+	mu       sync.Mutex
+	modified time.Time
+	entries  []harEntry
+	// next holds the index of the next response replayed for each request, so the responses recorded for the
+	// same request are replayed in order
+	next map[string]int
+}
+
+func newReplayHandler(route string, config *types.Replay, fallback http.Handler) *replayHandler {
+	match := config.Match
+	if len(match) == 0 {
+		match = defaultReplayMatch
+	}
+	matchHeaders := make([]string, 0, len(config.MatchHeaders))
+	for _, name := range config.MatchHeaders {
+		matchHeaders = append(matchHeaders, http.CanonicalHeaderKey(name))
+	}
+	return &replayHandler{
+		route:        route,
+		path:         utils.PathWithUserHome(config.File),
+		match:        match,
+		matchHeaders: matchHeaders,
+		fallback:     fallback,
+	}
+}
+
+func (h *replayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if slices.Contains(h.match, MATCH_BODY) && r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+		// Kept for the fallback, if the request is not replayed
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	entry, err := h.find(r, body)
+	if err != nil {
+		slog.Error("failed loading replay file", "route", h.route, "file", h.path, "error", err)
+		http.Error(w, fmt.Sprintf("failed loading replay file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if entry == nil {
+		if h.fallback != nil {
+			h.fallback.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, fmt.Sprintf("no recorded response matches %v %v", r.Method, r.URL.RequestURI()), http.StatusNotFound)
+		return
+	}
+	if accessEntry := getAccessEntry(r); accessEntry != nil {
+		accessEntry.upstream = "replay"
+	}
+	h.respond(w, r, entry)
+}
+
+// find returns the next recorded exchange matching the request, nil when none does
+func (h *replayHandler) find(r *http.Request, body []byte) (*harEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	var matching []int
+	for i := range h.entries {
+		if h.matches(&h.entries[i], r, body) {
+			matching = append(matching, i)
+		}
+	}
+	if len(matching) == 0 {
+		return nil, nil
+	}
+	key := fmt.Sprint(matching)
+	index := h.next[key] % len(matching)
+	h.next[key] = index + 1
+	return &h.entries[matching[index]], nil
+}
+
+// load reads the file again when it changed since the last time
+func (h *replayHandler) load() error {
+	info, err := os.Stat(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing recorded yet
+		h.entries, h.modified = []harEntry{}, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(h.entries) > 0 && info.ModTime().Equal(h.modified) {
+		return nil
+	}
+	// Serialised with the recorder, in case the route records to the same file
+	lock, _ := recordLocks.LoadOrStore(h.path, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	entries, err := readRecording(h.path)
+	lock.(*sync.Mutex).Unlock()
+	if err != nil {
+		return err
+	}
+	// The responses cut when recorded are not replayed, as they would be sent incomplete
+	h.entries, h.modified, h.next = []harEntry{}, info.ModTime(), map[string]int{}
+	for _, entry := range entries {
+		if entry.Response.Content.truncated() {
+			slog.Warn("recorded response body truncated, not replayed", "route", h.route, "file", h.path,
+				"method", entry.Request.Method, "url", entry.Request.URL, "size", entry.Response.Content.Size)
+			continue
+		}
+		h.entries = append(h.entries, entry)
+	}
+	return nil
+}
+
+// matches compares the configured parts of the request with the ones of the recorded exchange. The host is
+// ignored, so the recordings can be replayed anywhere
+func (h *replayHandler) matches(entry *harEntry, r *http.Request, body []byte) bool {
+	recorded, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return false
+	}
+	for _, part := range h.match {
+		switch part {
+		case MATCH_METHOD:
+			if entry.Request.Method != r.Method {
+				return false
+			}
+		case MATCH_PATH:
+			if recorded.Path != r.URL.Path {
+				return false
+			}
+		case MATCH_QUERY:
+			if !sameQuery(recorded.Query(), r.URL.Query()) {
+				return false
+			}
+		case MATCH_BODY:
+			recordedBody, err := entry.Request.PostData.body()
+			if err != nil || !bytes.Equal(recordedBody, body) {
+				return false
+			}
+		}
+	}
+	for _, name := range h.matchHeaders {
+		var values []string
+		for _, header := range entry.Request.Headers {
+			if http.CanonicalHeaderKey(header.Name) == name {
+				values = append(values, header.Value)
+			}
+		}
+		if !slices.Equal(values, r.Header.Values(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameQuery compares the queries regardless of the order of their parameters
+func sameQuery(a url.Values, b url.Values) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, values := range a {
+		if !slices.Equal(values, b[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// respond sends the recorded response. The redacted headers are left out, as their values were not recorded
+func (h *replayHandler) respond(w http.ResponseWriter, r *http.Request, entry *harEntry) {
+	body, err := entry.Response.Content.body()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid recorded response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, header := range entry.Response.Headers {
+		name := http.CanonicalHeaderKey(header.Name)
+		if header.Value == REDACTED || slices.Contains(hopHeaders, name) {
+			continue
+		}
+		w.Header().Add(name, header.Value)
+	}
+	w.WriteHeader(valueOrDefault(entry.Response.Status, http.StatusOK))
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"titan/pkg/types"
+)
+
+// rewriteRule replaces the parts of the path matching the expression
+type rewriteRule struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+// pathRewriter rewrites the path of the requests before they are sent upstream. The path is first stripped
+// of the prefix, then the rewrite rules are applied in order and finally the prefix is added.
+// All of them operate on the escaped path so encoded characters are preserved
+type pathRewriter struct {
+	stripPrefix string
+	rules       []rewriteRule
+	addPrefix   string
+}
+
+// newPathRewriter returns the pathRewriter for the route. By default the route source is stripped and the
+// target path added, so a request to "<source>/x" is sent to "<target>/x"
+func newPathRewriter(route types.Route, target *url.URL) (*pathRewriter, error) {
+	addPrefix := target.EscapedPath()
+	if route.AddPrefix != nil {
+		addPrefix = *route.AddPrefix
+	}
+
+	rules := make([]rewriteRule, 0, len(route.Rewrite))
+	for _, rule := range route.Rewrite {
+		match, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite expression %q: %w", rule.Match, err)
+		}
+		rules = append(rules, rewriteRule{match: match, replace: rule.Replace})
+	}
+
+	return &pathRewriter{
+		stripPrefix: routeStripPrefix(route),
+		rules:       rules,
+		addPrefix:   strings.TrimRight(addPrefix, "/"),
+	}, nil
+}
+
+// rewrite updates the path of the URL, keeping Path and RawPath consistent
+func (pr *pathRewriter) rewrite(u *url.URL) {
+	path := u.EscapedPath()
+
+	if stripped, found := stripPathPrefix(path, pr.stripPrefix); found {
+		path = stripped
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	for _, rule := range pr.rules {
+		path = rule.match.ReplaceAllString(path, rule.replace)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	path = pr.addPrefix + path
+
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		// The rules produced an invalid escaped path, use it as it is
+		u.Path = path
+		u.RawPath = ""
+		return
+	}
+	u.Path = unescaped
+	u.RawPath = path
+}
+
+// routeStripPrefix returns the prefix stripped from the path of the requests of the route, the source by default
+func routeStripPrefix(route types.Route) string {
+	stripPrefix := route.Source
+	if route.StripPrefix != nil {
+		stripPrefix = *route.StripPrefix
+	}
+	return strings.TrimRight(stripPrefix, "/")
+}
+
+// localPath returns the unescaped path of the request only stripped of the prefix, as seen by the handlers
+// answering the requests themselves. The rewrite rules and the prefix to add only apply to the upstream path
+func localPath(u *url.URL, stripPrefix string) string {
+	path := u.EscapedPath()
+	if stripped, found := stripPathPrefix(path, stripPrefix); found {
+		path = stripped
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	return "/" + strings.TrimPrefix(path, "/")
+}
+
+// stripPathPrefix removes the unescaped prefix from the start of the escaped path. The prefix only matches whole
+// segments, so "/app" is stripped from "/app/x" but not from "/application/x"
+func stripPathPrefix(path string, prefix string) (string, bool) {
+	if prefix == "" {
+		return path, false
+	}
+	rest := path
+	for _, segment := range strings.Split(strings.TrimPrefix(prefix, "/"), "/") {
+		if !strings.HasPrefix(rest, "/") {
+			return path, false
+		}
+		escaped, _, _ := strings.Cut(rest[1:], "/")
+		unescaped, err := url.PathUnescape(escaped)
+		if err != nil || unescaped != segment {
+			return path, false
+		}
+		rest = rest[1+len(escaped):]
+	}
+	return rest, true
+}
+
+// joinQuery merges the target and request query strings, the target one first
+func joinQuery(targetQuery string, requestQuery string) string {
+	if targetQuery == "" || requestQuery == "" {
+		return targetQuery + requestQuery
+	}
+	return targetQuery + "&" + requestQuery
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"titan/pkg/types"
+)
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+func TestPathRewriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   types.Route
+		target  string
+		request string
+		want    string
+	}{
+		{
+			name:    "strips the source",
+			route:   types.Route{Source: "/api"},
+			target:  "http://upstream",
+			request: "/api/users",
+			want:    "/users",
+		},
+		{
+			name:    "strips the whole path",
+			route:   types.Route{Source: "/api"},
+			target:  "http://upstream",
+			request: "/api",
+			want:    "/",
+		},
+		{
+			name:    "strips a source with trailing slash",
+			route:   types.Route{Source: "/api/"},
+			target:  "http://upstream",
+			request: "/api/users",
+			want:    "/users",
+		},
+		{
+			name:    "only strips whole segments",
+			route:   types.Route{Source: "/app"},
+			target:  "http://upstream",
+			request: "/application/x",
+			want:    "/application/x",
+		},
+		{
+			name:    "only strips at the start",
+			route:   types.Route{Source: "/api"},
+			target:  "http://upstream",
+			request: "/v1/api/users",
+			want:    "/v1/api/users",
+		},
+		{
+			name:    "strips the prefix once",
+			route:   types.Route{Source: "/api"},
+			target:  "http://upstream",
+			request: "/api/api/users",
+			want:    "/api/users",
+		},
+		{
+			name:    "adds the target path",
+			route:   types.Route{Source: "/api"},
+			target:  "http://upstream/svc/",
+			request: "/api/users",
+			want:    "/svc/users",
+		},
+		{
+			name:    "keeps the path with an empty strip prefix",
+			route:   types.Route{Source: "/api", StripPrefix: stringPtr("")},
+			target:  "http://upstream",
+			request: "/api/users",
+			want:    "/api/users",
+		},
+		{
+			name:    "strips a custom prefix",
+			route:   types.Route{Source: "/api", StripPrefix: stringPtr("/api/v1")},
+			target:  "http://upstream",
+			request: "/api/v1/users",
+			want:    "/users",
+		},
+		{
+			name:    "add prefix replaces the target path",
+			route:   types.Route{Source: "/api", AddPrefix: stringPtr("/v2")},
+			target:  "http://upstream/svc",
+			request: "/api/users",
+			want:    "/v2/users",
+		},
+		{
+			name: "applies the rules in order",
+			route: types.Route{Source: "/api", AddPrefix: stringPtr("/svc"), Rewrite: []types.RewriteRule{
+				{Match: "^/v1/(.*)$", Replace: "/v2/$1"},
+				{Match: "/users$", Replace: "/people"},
+			}},
+			target:  "http://upstream",
+			request: "/api/v1/users",
+			want:    "/svc/v2/people",
+		},
+		{
+			name:    "keeps encoded characters",
+			route:   types.Route{Source: "/api"},
+			target:  "http://upstream",
+			request: "/api/files/a%2Fb%20c",
+			want:    "/files/a%2Fb%20c",
+		},
+		{
+			name:    "strips an escaped source",
+			route:   types.Route{Source: "/my app"},
+			target:  "http://upstream",
+			request: "/my%20app/x",
+			want:    "/x",
+		},
+		{
+			name:    "does not strip a segment with an encoded slash",
+			route:   types.Route{Source: "/a/b"},
+			target:  "http://upstream",
+			request: "/a%2Fb/x",
+			want:    "/a%2Fb/x",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, err := url.Parse(test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rewriter, err := newPathRewriter(test.route, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			requestURL, err := url.Parse(test.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rewriter.rewrite(requestURL)
+			if got := requestURL.EscapedPath(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.RequestURI())
+	}))
+	defer upstream.Close()
+
+	proxy := newTestProxy()
+	routes, err := proxy.buildRoutes(types.Server{Routes: map[string]types.Route{
+		"root":  {Source: "/", Target: upstream.URL + "/root"},
+		"api":   {Source: "/api", Target: upstream.URL + "/svc?key=1"},
+		"users": {Source: "/api/users", Target: upstream.URL + "/people"},
+		"admin": {Source: "/api", Target: upstream.URL + "/admin", Match: types.RouteMatch{Methods: []string{"DELETE"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method  string
+		request string
+		want    string
+	}{
+		{http.MethodGet, "/", "/root/"},
+		{http.MethodGet, "/other/page", "/root/other/page"},
+		{http.MethodGet, "/api/orders", "/svc/orders?key=1"},
+		{http.MethodGet, "/api/orders?page=2", "/svc/orders?key=1&page=2"},
+		{http.MethodGet, "/api/users/7", "/people/7"},
+		{http.MethodGet, "/api/orders%2F7", "/svc/orders%2F7?key=1"},
+		{http.MethodDelete, "/api/orders/7", "/admin/orders/7"},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.request, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.request, nil)
+			route := matchRoute(routes, request, func(string) bool { return false })
+			if route == nil {
+				t.Fatal("no route matched")
+			}
+			recorder := httptest.NewRecorder()
+			route.handler.ServeHTTP(recorder, request)
+			if got := recorder.Body.String(); got != test.want {
+				t.Errorf("route [%v] got %q, want %q", route.Name, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"titan/internal/utils"
+	"titan/pkg/types"
+)
+
+// Defaults for the static routes
+const (
+	defaultIndex        = "index.html"
+	defaultCacheControl = "no-cache"
+)
+
+// precompressed are the encodings of the precompressed files looked for, in order of preference, along with
+// the extension of their files
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// staticHandler serves the files of a local directory. Directories are only listed when enabled
+type staticHandler struct {
+	dir          string
+	root         http.Dir
+	stripPrefix  string
+	index        string
+	fallback     string
+	cacheControl string
+	listing      bool
+}
+
+func newStaticHandler(route types.Route) *staticHandler {
+	config := route.Static
+	dir := utils.PathWithUserHome(config.Dir)
+	return &staticHandler{
+		dir:          dir,
+		root:         http.Dir(dir),
+		stripPrefix:  routeStripPrefix(route),
+		index:        valueOrDefault(config.Index, defaultIndex),
+		fallback:     config.Fallback,
+		cacheControl: valueOrDefault(config.CacheControl, defaultCacheControl),
+		listing:      config.Listing,
+	}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean(localPath(r.URL, h.stripPrefix))
+	if entry := getAccessEntry(r); entry != nil {
+		entry.upstream = filepath.Join(h.dir, filepath.FromSlash(name))
+	}
+
+	info, err := h.stat(name)
+	switch {
+	case err != nil:
+		h.notFound(w, r, name)
+	case info.IsDir():
+		// Relative links of the index file need the path to end with a slash
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		index := path.Join(name, h.index)
+		if indexInfo, err := h.stat(index); err == nil && !indexInfo.IsDir() {
+			h.serveFile(w, r, index)
+			return
+		}
+		if h.listing {
+			h.list(w, name)
+			return
+		}
+		h.notFound(w, r, name)
+	default:
+		h.serveFile(w, r, name)
+	}
+}
+
+func (h *staticHandler) stat(name string) (fs.FileInfo, error) {
+	file, err := h.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+// notFound serves the fallback file for the paths without extension, as the routes of single page applications,
+// or not found otherwise
+func (h *staticHandler) notFound(w http.ResponseWriter, r *http.Request, name string) {
+	if h.fallback != "" && path.Ext(name) == "" {
+		h.serveFile(w, r, path.Clean("/"+h.fallback))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// serveFile sends the file, or its precompressed version when the client accepts it. Conditional and range
+// requests are handled too
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	w.Header().Set("Cache-Control", h.cacheControl)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, candidate := range precompressed {
+		if !acceptsEncoding(accepted, candidate.encoding) {
+			continue
+		}
+		file, err := h.root.Open(name + candidate.extension)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Encoding", candidate.encoding)
+		w.Header().Add("Vary", "Accept-Encoding")
+		http.ServeContent(w, r, name, info.ModTime(), file)
+		return
+	}
+
+	file, err := h.root.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// list sends the entries of the directory as links
+func (h *staticHandler) list(w http.ResponseWriter, name string) {
+	entries, err := os.ReadDir(filepath.Join(h.dir, filepath.FromSlash(name)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", h.cacheControl)
+	fmt.Fprintf(w, "<!doctype html>\n<title>%v</title>\n<h1>%v</h1>\n<pre>\n", html.EscapeString(name), html.EscapeString(name))
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(w, "<a href=\"%v\">%v</a>\n", html.EscapeString(link.String()), html.EscapeString(entryName))
+	}
+	fmt.Fprint(w, "</pre>\n")
+}
+
+// acceptsEncoding checks if the Accept-Encoding header allows the encoding
+func acceptsEncoding(header string, encoding string) bool {
+	for value := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(value), ";")
+		if strings.EqualFold(strings.TrimSpace(name), encoding) {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"titan/internal/certs"
+	"titan/pkg/types"
+)
+
+// SSL modes
+const (
+	// HTTP_ONLY serves only HTTP
+	HTTP_ONLY = "http"
+	// HTTPS_ONLY serves only HTTPS
+	HTTPS_ONLY = "https"
+	// BOTH serves the routes on both HTTP and HTTPS
+	BOTH = "both"
+	// REDIRECT serves the routes on HTTPS and redirects HTTP requests to it
+	REDIRECT = "redirect"
+)
+
+// sslMode returns the configured SSL mode. When none is configured HTTPS is served, along HTTP, only if
+// the certificate and key are provided or issued automatically
+func sslMode(ssl types.SSL) (string, error) {
+	hasCertificate := ssl.Auto || (ssl.Cert != "" && ssl.Key != "")
+	switch ssl.Mode {
+	case "":
+		if hasCertificate {
+			return BOTH, nil
+		}
+		return HTTP_ONLY, nil
+	case HTTP_ONLY:
+		return HTTP_ONLY, nil
+	case HTTPS_ONLY, BOTH, REDIRECT:
+		if !hasCertificate {
+			return "", fmt.Errorf("ssl mode %q requires ssl.cert and ssl.key, or ssl.auto", ssl.Mode)
+		}
+		return ssl.Mode, nil
+	}
+	return "", fmt.Errorf("invalid ssl mode %q, valid ones are http, https, both and redirect", ssl.Mode)
+}
+
+// redirectToHTTPS returns a handler redirecting the requests to the same URL on the HTTPS port
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// tlsConfig returns the TLS configuration of the HTTPS server when the certificate is issued by the local CA.
+// It returns nil when the configured cert and key files are used instead
+func tlsConfig(ssl types.SSL, host string, stateDir string) (*tls.Config, error) {
+	if !ssl.Auto {
+		return nil, nil
+	}
+	authority := certs.NewAuthority(certs.Dir(stateDir))
+	hosts := certs.Hosts(host, ssl.SANs)
+	if _, err := authority.Ensure(hosts, false); err != nil {
+		return nil, err
+	}
+	return &tls.Config{GetCertificate: authority.GetCertificate(hosts)}, nil
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+	"titan/pkg/types"
+)
+
+// Defaults for the upstream transport
+const (
+	defaultDialTimeout         = 5 * time.Second
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 32
+)
+
+// newTransport returns a transport tuned for proxying to local dev servers: connections are kept alive and
+// reused across requests, and HTTP/2 is attempted for TLS upstreams
+func newTransport(config types.Transport, idleTimeout time.Duration) *http.Transport {
+	dialTimeout := valueOrDefault(config.DialTimeout, defaultDialTimeout)
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialer.DialContext
+	if idleTimeout > 0 {
+		dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return newIdleConn(conn, idleTimeout), nil
+		}
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          valueOrDefault(config.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   valueOrDefault(config.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		IdleConnTimeout:       valueOrDefault(config.IdleConnTimeout, defaultIdleConnTimeout),
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: config.ResponseTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// routeTransport returns the shared transport unless the route overrides any of its timeouts, in which case
+// a dedicated transport is created for it
+func routeTransport(shared *http.Transport, serverConfig types.Transport, route types.Route) *http.Transport {
+	if route.DialTimeout == 0 && route.ResponseTimeout == 0 && route.Streaming.IdleTimeout == 0 {
+		return shared
+	}
+	config := serverConfig
+	if route.DialTimeout != 0 {
+		config.DialTimeout = route.DialTimeout
+	}
+	if route.ResponseTimeout != 0 {
+		config.ResponseTimeout = route.ResponseTimeout
+	}
+	return newTransport(config, route.Streaming.IdleTimeout)
+}
+
+// idleConn is a connection that times out when there is no traffic for a while. The deadline is extended
+// on every read and write, so it only applies to idle connections, not to long lived busy ones
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func newIdleConn(conn net.Conn, timeout time.Duration) *idleConn {
+	c := &idleConn{Conn: conn, timeout: timeout}
+	c.extend()
+	return c
+}
+
+func (c *idleConn) extend() {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.extend()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.extend()
+	}
+	return n, err
+}
+
+func valueOrDefault[T comparable](value T, defaultValue T) T {
+	var zero T
+	if value == zero {
+		return defaultValue
+	}
+	return value
+}
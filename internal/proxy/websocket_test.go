@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"titan/pkg/types"
+)
+
+// webSocketGUID is appended to the key of the handshake to compute the accept value, as RFC 6455 defines
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+)
+
+func webSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// writeFrame writes a final frame. Clients have to mask their frames, servers must not
+func writeFrame(w io.Writer, opcode byte, payload []byte, masked bool) error {
+	frame := []byte{0x80 | opcode}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a final frame, unmasking its payload
+func readFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	opcode, masked := header[0]&0x0f, header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(r, extended); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(r, extended); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+// webSocketEcho sends back every frame received until the client closes the connection
+func webSocketEcho(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgrade(r) || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "websocket expected", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("failed hijacking the upstream connection: %v", err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %v\r\nX-Echo-Path: %v\r\n\r\n", webSocketAccept(r.Header.Get("Sec-WebSocket-Key")), r.URL.Path)
+		rw.Flush()
+		for {
+			opcode, payload, err := readFrame(rw)
+			if err != nil {
+				return
+			}
+			writeFrame(rw, opcode, payload, false)
+			rw.Flush()
+			if opcode == opClose {
+				return
+			}
+		}
+	})
+}
+
+// dialWebSocket opens a WebSocket to the path of the server, returning the connection and the handshake response
+func dialWebSocket(t *testing.T, server *httptest.Server, path string) (net.Conn, *bufio.Reader, *http.Response) {
+	address := strings.TrimPrefix(strings.TrimPrefix(server.URL, "http://"), "https://")
+	var conn net.Conn
+	var err error
+	if server.TLS != nil {
+		conn, err = tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
+	} else {
+		conn, err = net.Dial("tcp", address)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	key := base64.StdEncoding.EncodeToString([]byte("titan-test-key!!"))
+	fmt.Fprintf(conn, "GET %v HTTP/1.1\r\nHost: %v\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %v\r\nSec-WebSocket-Version: 13\r\nOrigin: http://localhost:3000\r\n\r\n", path, address, key)
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		t.Fatalf("unexpected status %v", response.Status)
+	}
+	if got := response.Header.Get("Sec-WebSocket-Accept"); got != webSocketAccept(key) {
+		conn.Close()
+		t.Fatalf("unexpected accept %q", got)
+	}
+	return conn, reader, response
+}
+
+// lockedBuffer is a buffer safe to write from the handlers whilst the test reads it
+type lockedBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+func TestWebSocketProxying(t *testing.T) {
+	upstream := httptest.NewServer(webSocketEcho(t))
+	defer upstream.Close()
+
+	proxy := newTestProxy()
+	// The response rules put a headerWriter in front of the reverse proxy, which applies them when hijacked
+	err := proxy.SetRoutes(types.Server{AccessLog: types.AccessLog{Enabled: true}, Routes: map[string]types.Route{
+		"hmr": {Source: "/hmr", Target: upstream.URL + "/ws", CORS: &types.CORS{AllowOrigins: []string{"*"}},
+			Headers: types.Headers{Response: types.HeaderRules{Set: map[string]string{"X-Route": "{route}"}}}},
+		"idle": {Source: "/idle", Target: upstream.URL + "/ws", Streaming: types.Streaming{IdleTimeout: time.Second}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &lockedBuffer{}
+	accessLog, err := NewAccessLog(types.AccessLog{Enabled: true, Format: JSON}, slog.New(slog.NewJSONHandler(logs, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := accessLog.Middleware(proxy.handler(true))
+
+	for _, listener := range []struct {
+		name  string
+		start func(http.Handler) *httptest.Server
+	}{
+		{"http", httptest.NewServer},
+		{"https", httptest.NewTLSServer},
+	} {
+		for _, path := range []string{"/hmr/updates", "/idle/updates"} {
+			t.Run(listener.name+path, func(t *testing.T) {
+				server := listener.start(handler)
+				defer server.Close()
+				conn, reader, response := dialWebSocket(t, server, path)
+				defer conn.Close()
+				if got := response.Header.Get("X-Echo-Path"); got != "/ws/updates" {
+					t.Errorf("upstream got path %q", got)
+				}
+				if path == "/hmr/updates" {
+					if got := response.Header.Get("X-Route"); got != "hmr" {
+						t.Errorf("response rules not applied to the upgrade, got X-Route %q", got)
+					}
+					if got := response.Header.Get("Access-Control-Allow-Origin"); got == "" {
+						t.Error("CORS policy not applied to the upgrade")
+					}
+				}
+
+				for _, message := range []string{"hello", strings.Repeat("x", 300), strings.Repeat("y", 70000)} {
+					if err := writeFrame(conn, opText, []byte(message), true); err != nil {
+						t.Fatal(err)
+					}
+					opcode, payload, err := readFrame(reader)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if opcode != opText || string(payload) != message {
+						t.Fatalf("unexpected frame %x of %d bytes", opcode, len(payload))
+					}
+				}
+				if err := writeFrame(conn, opClose, nil, true); err != nil {
+					t.Fatal(err)
+				}
+				if opcode, _, err := readFrame(reader); err != nil || opcode != opClose {
+					t.Fatalf("unexpected close frame %x: %v", opcode, err)
+				}
+			})
+		}
+	}
+
+	// The upgraded requests are logged once the connections are closed
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(logs.String(), `"status":101`) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := strings.Count(logs.String(), `"status":101`); got != 4 {
+		t.Errorf("expected 4 upgraded requests logged, got %d:\n%v", got, logs.String())
+	}
+}
@@ -0,0 +1,174 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+	"titan/internal/core"
+	"titan/internal/events"
+	"titan/internal/proxy"
+	"titan/internal/tasks"
+	"titan/pkg/config"
+	"titan/pkg/types"
+)
+
+// pollInterval is how often the config file is checked for changes
+const pollInterval = time.Second
+
+// Changes holds what was applied when reloading the configuration
+type Changes struct {
+	RoutesAdded   []string      `json:"routesAdded,omitempty"`
+	RoutesRemoved []string      `json:"routesRemoved,omitempty"`
+	RoutesChanged []string      `json:"routesChanged,omitempty"`
+	Tasks         tasks.Changes `json:"tasks"`
+	// Ignored lists the changed settings that only apply after restarting serve
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+// Watcher reloads the configuration file when it changes while serve is running. Routes are swapped on the
+// proxy and only the tasks whose definition changed are started, stopped or restarted
+type Watcher struct {
+	container *core.Container
+	proxy     *proxy.Proxy
+	tasks     *tasks.Manager
+	// started is the configuration serve started with, which the settings that cannot be reloaded come from
+	started *types.Config
+	current *types.Config
+}
+
+// NewWatcher returns a Watcher applying the changes to the proxy and tasks
+func NewWatcher(container *core.Container, proxy *proxy.Proxy, tasks *tasks.Manager) *Watcher {
+	return &Watcher{
+		container: container,
+		proxy:     proxy,
+		tasks:     tasks,
+		started:   container.ConfigData.Config,
+		current:   container.ConfigData.Config,
+	}
+}
+
+// Watch polls the config file until the context is done, reloading it on every change
+func (w *Watcher) Watch(ctx context.Context) {
+	path := w.container.ConfigData.ConfigFilePath
+	lastModified, lastSize := stat(path)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modified, size := stat(path)
+		if modified.Equal(lastModified) && size == lastSize {
+			continue
+		}
+		lastModified, lastSize = modified, size
+		if err := w.Reload(); err != nil {
+			w.container.Logger.Error("failed reloading configuration, keeping the current one", "file", path, "error", err)
+		}
+	}
+}
+
+// Reload loads and validates the config file, applying it if valid
+func (w *Watcher) Reload() error {
+	newConfig, err := config.NewConfig(w.container.ConfigData.ConfigFilePath)
+	if err != nil {
+		return err
+	}
+	if issues := config.Validate(newConfig); len(issues) > 0 {
+		return errors.Join(issues...)
+	}
+	profile, found := newConfig.Server.Profiles[w.container.Command.Profile]
+	if !found {
+		return fmt.Errorf("profile [%v] not found in config", w.container.Command.Profile)
+	}
+
+	// The tasks are checked before swapping the routes, so an invalid task does not leave the new routes live
+	if err := tasks.Validate(newConfig, profile); err != nil {
+		return err
+	}
+
+	changes := diff(w.started, w.current, newConfig)
+	if err := w.proxy.SetRoutes(newConfig.Server); err != nil {
+		return err
+	}
+	if changes.Tasks, err = w.tasks.Apply(newConfig, profile); err != nil {
+		// Back to the routes of the configuration still applied
+		if rollbackErr := w.proxy.SetRoutes(w.current.Server); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("failed restoring the routes: %w", rollbackErr))
+		}
+		return err
+	}
+	w.current = newConfig
+
+	w.container.Logger.Info("configuration reloaded",
+		"routesAdded", changes.RoutesAdded,
+		"routesRemoved", changes.RoutesRemoved,
+		"routesChanged", changes.RoutesChanged,
+		"tasksStarted", changes.Tasks.Started,
+		"tasksStopped", changes.Tasks.Stopped,
+		"tasksRestarted", changes.Tasks.Restarted,
+	)
+	if len(changes.Ignored) > 0 {
+		w.container.Logger.Warn("some changes require restarting serve to apply", "settings", changes.Ignored)
+	}
+	w.container.Events.Emit(events.Event{Type: events.CONFIG_RELOADED, Data: changes})
+	return nil
+}
+
+// diff compares the routes of the current and next configurations, and the settings that cannot be reloaded
+// of the next one against the configuration serve started with
+func diff(started *types.Config, current *types.Config, next *types.Config) Changes {
+	var changes Changes
+	for name, route := range next.Server.Routes {
+		previous, found := current.Server.Routes[name]
+		switch {
+		case !found:
+			changes.RoutesAdded = append(changes.RoutesAdded, name)
+		case !reflect.DeepEqual(previous, route):
+			changes.RoutesChanged = append(changes.RoutesChanged, name)
+		}
+	}
+	for name := range current.Server.Routes {
+		if _, found := next.Server.Routes[name]; !found {
+			changes.RoutesRemoved = append(changes.RoutesRemoved, name)
+		}
+	}
+	slices.Sort(changes.RoutesAdded)
+	slices.Sort(changes.RoutesRemoved)
+	slices.Sort(changes.RoutesChanged)
+
+	ignored := map[string]bool{
+		"versions":          !reflect.DeepEqual(started.Versions, next.Versions),
+		"logging":           !reflect.DeepEqual(started.Logging, next.Logging),
+		"server.host":       started.Server.Host != next.Server.Host,
+		"server.port":       started.Server.Port != next.Server.Port,
+		"server.ssl":        !reflect.DeepEqual(started.Server.SSL, next.Server.SSL),
+		"server.access-log": started.Server.AccessLog != next.Server.AccessLog,
+		"server.transport":  started.Server.Transport != next.Server.Transport,
+		"server.admin":      started.Server.Admin != next.Server.Admin,
+		"server.metrics":    started.Server.Metrics != next.Server.Metrics,
+	}
+	for setting, changed := range ignored {
+		if changed {
+			changes.Ignored = append(changes.Ignored, setting)
+		}
+	}
+	slices.Sort(changes.Ignored)
+	return changes
+}
+
+// stat returns the modification time and size of the file, zero values if it cannot be read
+func stat(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxLogLines is how many of the latest lines are kept
+const maxLogLines = 500
+
+// maxLineLength is the longest line kept, in bytes. Longer ones, like minified output or progress bars without
+// new lines, are split
+const maxLineLength = 4096
+
+// ansiSequence matches the escape sequences, like colours, of the output
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// StripANSI removes the escape sequences, like colours, from the output line
+func StripANSI(line string) string {
+	return ansiSequence.ReplaceAllString(line, "")
+}
+
+// LogBuffer keeps the latest lines written to it, like the output of a task
+type LogBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+// Write splits the output in lines, keeping the incomplete last one until the rest of it is written. Lines
+// longer than maxLineLength are split at it
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.partial = append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		switch {
+		case i >= 0 && i <= maxLineLength:
+			b.add(string(bytes.TrimSuffix(b.partial[:i], []byte("\r"))))
+			b.partial = b.partial[i+1:]
+		case len(b.partial) > maxLineLength:
+			// Split before the limit when it falls in the middle of a character
+			i = maxLineLength
+			for i > maxLineLength-utf8.UTFMax && !utf8.RuneStart(b.partial[i]) {
+				i--
+			}
+			b.add(string(b.partial[:i]))
+			b.partial = b.partial[i:]
+		default:
+			return len(p), nil
+		}
+	}
+}
+
+func (b *LogBuffer) add(line string) {
+	if len(b.lines) == maxLogLines {
+		b.lines = append(b.lines[:0], b.lines[1:]...)
+	}
+	b.lines = append(b.lines, line)
+}
+
+// Tail returns up to the given number of latest lines. All of them when n is not positive
+func (b *LogBuffer) Tail(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := 0
+	if n > 0 && len(b.lines) > n {
+		start = len(b.lines) - n
+	}
+	lines := make([]string, len(b.lines)-start)
+	copy(lines, b.lines[start:])
+	return lines
+}
@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLogBufferSplitsLongLines(t *testing.T) {
+	var logs LogBuffer
+	// A progress bar redrawn without new lines, written in chunks
+	for range 3 * maxLineLength / 100 {
+		logs.Write([]byte(strings.Repeat("#", 99) + "\r"))
+	}
+	if len(logs.partial) > maxLineLength {
+		t.Fatalf("pending line of %d bytes, above the limit", len(logs.partial))
+	}
+	lines := logs.Tail(0)
+	if len(lines) != 2 || len(lines[0]) != maxLineLength || len(lines[1]) != maxLineLength {
+		t.Fatalf("unexpected lines of %v", lineLengths(lines))
+	}
+
+	logs.Write([]byte("done\nnext"))
+	lines = logs.Tail(0)
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, "done") || len(last) > maxLineLength {
+		t.Errorf("unexpected last line of %d bytes", len(last))
+	}
+	if string(logs.partial) != "next" {
+		t.Errorf("unexpected pending line %q", logs.partial)
+	}
+}
+
+func TestLogBufferDoesNotSplitCharacters(t *testing.T) {
+	var logs LogBuffer
+	logs.Write([]byte("a" + strings.Repeat("é", maxLineLength)))
+	for _, line := range logs.Tail(0) {
+		if !utf8.ValidString(line) {
+			t.Fatalf("line split in the middle of a character")
+		}
+	}
+	if !utf8.Valid(logs.partial) {
+		t.Fatalf("pending line split in the middle of a character")
+	}
+}
+
+func lineLengths(lines []string) []int {
+	lengths := make([]int, len(lines))
+	for i, line := range lines {
+		lengths[i] = len(line)
+	}
+	return lengths
+}
@@ -1,42 +1,448 @@
 package tasks
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 	"titan/internal/core"
+	"titan/internal/events"
 	"titan/internal/utils"
 	"titan/pkg/types"
 )
 
-func StartTasks(errorChannel chan error, container *core.Container) {
+// Task states
+const (
+	RUNNING  = "running"
+	STOPPING = "stopping"
+	STOPPED  = "stopped"
+	FAILED   = "failed"
+	EXITED   = "exited"
+)
 
-	for _, task := range container.ConfigData.Profile.Tasks {
-		go func() {
-			// We only have application type tasks. If we ever add any other type we should add the relevant logic here
-			app, err := getApp(container, task.Name)
-			if err != nil {
-				errorChannel <- err
-				return
-			}
+// ErrTaskNotFound is returned when operating on a task that is not part of the profile
+var ErrTaskNotFound = errors.New("task not found")
+
+// definition holds what a task runs. A task is restarted on reload only when its definition changes
+type definition struct {
+	name    string
+	path    string
+	command string
+	args    []string
+}
+
+func (d definition) equal(other definition) bool {
+	return d.path == other.path && d.command == other.command && slices.Equal(d.args, other.args)
+}
+
+// State holds the state of a task
+type State struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"startedAt,omitzero"`
+	UptimeMs  int64     `json:"uptimeMs,omitempty"`
+	Restarts  int       `json:"restarts"`
+	ExitCode  *int      `json:"exitCode,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// task is a task of the profile, kept across restarts
+type task struct {
+	definition definition
+	logs       *LogBuffer
+
+	// cancel and done belong to the current run, nil if it never ran
+	cancel context.CancelFunc
+	done   chan struct{}
+	// stopping is set while waiting for the current run to exit. The lock of the manager is not held meanwhile
+	stopping bool
+
+	mu    sync.Mutex
+	state State
+}
+
+func (t *task) running() bool {
+	if t.done == nil {
+		return false
+	}
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (t *task) update(fn func(state *State)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.state)
+}
+
+func (t *task) snapshot() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.state
+	if state.State == RUNNING && !state.StartedAt.IsZero() {
+		state.UptimeMs = time.Since(state.StartedAt).Milliseconds()
+	}
+	return state
+}
+
+// Changes holds the names of the tasks affected when applying a profile
+type Changes struct {
+	Started   []string `json:"started,omitempty"`
+	Stopped   []string `json:"stopped,omitempty"`
+	Restarted []string `json:"restarted,omitempty"`
+}
 
-			action, err := getAppAction(app, task.Action)
-			if err != nil {
-				errorChannel <- err
-				return
+// Empty indicates no task was affected
+func (c Changes) Empty() bool {
+	return len(c.Started) == 0 && len(c.Stopped) == 0 && len(c.Restarted) == 0
+}
+
+// Manager runs the tasks of the profile, keeping track of them so they can be stopped or restarted when
+// the configuration changes or when requested
+type Manager struct {
+	container    *core.Container
+	errorChannel chan error
+
+	// output is where the output of the tasks is written to, besides being kept for inspection
+	output io.Writer
+
+	mu    sync.Mutex
+	tasks map[string]*task
+	// stopped is set once all the tasks are stopped, so no more are started
+	stopped bool
+}
+
+// NewManager returns a Manager. Tasks failing are reported to the error channel
+func NewManager(errorChannel chan error, container *core.Container) *Manager {
+	return &Manager{
+		container:    container,
+		errorChannel: errorChannel,
+		tasks:        map[string]*task{},
+	}
+}
+
+// SetOutput sets where the output of the tasks is written to, besides being kept for inspection. Defaults to
+// stdout, or stderr when a structured output is requested
+func (m *Manager) SetOutput(w io.Writer) {
+	m.output = w
+}
+
+// Apply starts the tasks of the profile not running yet, stops the ones no longer in it and restarts the
+// ones whose definition changed
+func (m *Manager) Apply(config *types.Config, profile types.Profile) (Changes, error) {
+	definitions, names, err := profileDefinitions(config, profile)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return Changes{}, errors.New("tasks are stopped")
+	}
+
+	var changes Changes
+	var stopping []*task
+	var restarting []*task
+	for name, t := range m.tasks {
+		if _, found := definitions[name]; !found {
+			stopping = append(stopping, m.stop(t))
+			delete(m.tasks, name)
+			changes.Stopped = append(changes.Stopped, name)
+		}
+	}
+	for _, name := range names {
+		def := definitions[name]
+		t, found := m.tasks[name]
+		switch {
+		case !found:
+			t = &task{definition: def, logs: &LogBuffer{}, state: State{Name: name, State: STOPPED}}
+			m.tasks[name] = t
+			changes.Started = append(changes.Started, name)
+			m.start(t)
+		case t.definition.equal(def):
+		default:
+			// Started again once the current run exits
+			stopping = append(stopping, m.stop(t))
+			t.definition = def
+			restarting = append(restarting, t)
+			changes.Restarted = append(changes.Restarted, name)
+		}
+	}
+	m.mu.Unlock()
+
+	m.wait(stopping...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range restarting {
+		m.restart(t)
+	}
+	slices.Sort(changes.Stopped)
+	return changes, nil
+}
+
+// Validate checks the tasks of the profile can be applied with the configuration, without applying them
+func Validate(config *types.Config, profile types.Profile) error {
+	_, _, err := profileDefinitions(config, profile)
+	return err
+}
+
+// profileDefinitions returns the definitions of the tasks of the profile by name, and the names in order
+func profileDefinitions(config *types.Config, profile types.Profile) (map[string]definition, []string, error) {
+	definitions := map[string]definition{}
+	var names []string
+	for _, task := range profile.Tasks {
+		// We only have application type tasks. If we ever add any other type we should add the relevant logic here
+		app, err := getApp(config, task.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		action, err := getAppAction(app, task.Action)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := fmt.Sprintf("%v:%v", app.Name, task.Action)
+		definitions[name] = definition{name: name, path: app.Path, command: action.Command, args: action.Args}
+		names = append(names, name)
+	}
+	return definitions, names, nil
+}
+
+// States returns the state of every task, sorted by name
+func (m *Manager) States() []State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	states := make([]State, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		states = append(states, t.snapshot())
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	return states
+}
+
+// Logs returns up to the given number of latest output lines of the task
+func (m *Manager) Logs(name string, lines int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, found := m.tasks[name]
+	if !found {
+		return nil, fmt.Errorf("%w: %v", ErrTaskNotFound, name)
+	}
+	return t.logs.Tail(lines), nil
+}
+
+// Start starts the task if it is not running
+func (m *Manager) Start(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.get(name)
+	if err != nil {
+		return err
+	}
+	if t.stopping {
+		return fmt.Errorf("task [%v] is stopping", name)
+	}
+	if t.running() {
+		return fmt.Errorf("task [%v] is already running", name)
+	}
+	m.start(t)
+	return nil
+}
+
+// Stop stops the task and waits for it to exit. It remains stopped until started again
+func (m *Manager) Stop(name string) error {
+	m.mu.Lock()
+	t, err := m.get(name)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.stop(t)
+	m.mu.Unlock()
+	m.wait(t)
+	return nil
+}
+
+// Restart stops the task, if running, and starts it again
+func (m *Manager) Restart(name string) error {
+	m.mu.Lock()
+	t, err := m.get(name)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.stop(t)
+	m.mu.Unlock()
+	m.wait(t)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The task may have been replaced by a reload meanwhile
+	current, err := m.get(name)
+	if err != nil {
+		return err
+	}
+	m.restart(current)
+	return nil
+}
+
+// StopAll stops all the running tasks and waits for them to exit
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	m.stopped = true
+	stopping := make([]*task, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		stopping = append(stopping, m.stop(t))
+	}
+	m.mu.Unlock()
+	m.wait(stopping...)
+}
+
+func (m *Manager) get(name string) (*task, error) {
+	if m.stopped {
+		return nil, errors.New("tasks are stopped")
+	}
+	t, found := m.tasks[name]
+	if !found {
+		return nil, fmt.Errorf("%w: %v", ErrTaskNotFound, name)
+	}
+	return t, nil
+}
+
+func (m *Manager) start(t *task) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.cancel, t.done, t.stopping = cancel, done, false
+	def := t.definition
+	t.update(func(state *State) {
+		*state = State{Name: def.name, State: RUNNING, StartedAt: time.Now(), Restarts: state.Restarts}
+	})
+
+	go func() {
+		defer close(done)
+		m.container.Logger.Info("task executed on project", "task", def.name)
+		m.container.Events.Emit(events.Event{Type: events.TASK_STATE, Task: def.name, State: RUNNING})
+
+		options := utils.NewExecCommandOptions(m.container.SharedEnvironment, def.path, def.command, def.args...)
+		options.Context = ctx
+		options.Started = func(pid int) {
+			t.update(func(state *State) { state.PID = pid })
+		}
+		// Keep stdout clean when a structured output is requested. The latest lines are kept to be inspected
+		output := m.output
+		if output == nil {
+			output = os.Stdout
+			if m.container.Events.Structured() {
+				output = os.Stderr
+			}
+		}
+		options.Output = io.MultiWriter(output, t.logs)
+		err := utils.ExecCommand(options)
+		if ctx.Err() != nil {
+			// Stopped on purpose, not a failure
+			t.update(func(state *State) {
+				state.State = STOPPED
+				state.ExitCode = exitCode(err)
+			})
+			m.container.Events.Emit(events.Event{Type: events.TASK_STATE, Task: def.name, State: STOPPED})
+			return
+		}
+		if err != nil {
+			t.update(func(state *State) {
+				state.State = FAILED
+				state.ExitCode = exitCode(err)
+				state.Error = err.Error()
+			})
+			m.container.Events.Emit(events.Event{Type: events.TASK_STATE, Task: def.name, State: FAILED, Error: err.Error()})
+			// Give up reporting it if the task is stopped meanwhile, as nobody may be listening anymore
+			select {
+			case m.errorChannel <- err:
+			case <-ctx.Done():
 			}
-			container.Logger.Info("task executed on project", "task", task.Action, "project", app.Name)
+			return
+		}
+		t.update(func(state *State) {
+			state.State = EXITED
+			state.ExitCode = exitCode(nil)
+		})
+		m.container.Events.Emit(events.Event{Type: events.TASK_STATE, Task: def.name, State: EXITED}.WithExitCode(0))
+	}()
+}
+
+// restart starts the task again once stopped, unless it was started or removed meanwhile
+func (m *Manager) restart(t *task) {
+	if m.stopped || m.tasks[t.definition.name] != t || t.running() {
+		return
+	}
+	t.update(func(state *State) { state.Restarts++ })
+	m.start(t)
+}
 
-			options := utils.NewExecCommandOptions(container.SharedEnvironment, app.Path, action.Command, action.Args...)
-			err = utils.ExecCommand(options)
-			if err != nil {
-				errorChannel <- err
-				return
+// stop asks the task to exit, returning it so it can be waited for once the lock of the manager is released
+func (m *Manager) stop(t *task) *task {
+	if !t.running() {
+		return t
+	}
+	if !t.stopping {
+		m.container.Logger.Info("stopping task", "task", t.definition.name)
+		t.stopping = true
+		t.update(func(state *State) {
+			// The run may have just ended on its own
+			if state.State == RUNNING {
+				state.State = STOPPING
 			}
-		}()
+		})
+		t.cancel()
+	}
+	return t
+}
+
+// wait waits for the tasks to exit. It must be called without holding the lock of the manager, so the state
+// of the tasks can be read meanwhile
+func (m *Manager) wait(tasks ...*task) {
+	for _, t := range tasks {
+		m.mu.Lock()
+		done := t.done
+		m.mu.Unlock()
+		if done != nil {
+			<-done
+		}
+		m.mu.Lock()
+		if !t.running() {
+			t.stopping = false
+		}
+		m.mu.Unlock()
+	}
+}
+
+// exitCode returns the exit code of the process, nil if it is unknown
+func exitCode(err error) *int {
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil
+		}
+		code = exitErr.ExitCode()
 	}
+	return &code
 }
 
-func getApp(container *core.Container, appName string) (*types.Application, error) {
-	if app, found := container.ConfigData.Config.Server.Applications[appName]; found {
+func getApp(config *types.Config, appName string) (*types.Application, error) {
+	if app, found := config.Server.Applications[appName]; found {
 		return &app, nil
 	}
 
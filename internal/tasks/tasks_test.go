@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+	"titan/internal/core"
+	"titan/internal/events"
+	"titan/pkg/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// slowStop is a task taking a second to exit once asked to
+const slowStop = "trap 'sleep 1; exit 0' TERM; while true; do sleep 0.05; done"
+
+func newTestManager(t *testing.T) (*Manager, *types.Config, types.Profile) {
+	container := &core.Container{
+		Logger:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Events:            events.NewEmitter(events.TEXT, io.Discard),
+		SharedEnvironment: os.Environ(),
+	}
+	manager := NewManager(make(chan error, 10), container)
+	manager.SetOutput(io.Discard)
+	config := &types.Config{Server: types.Server{Applications: map[string]types.Application{
+		"app": {Name: "app", Path: t.TempDir(), Actions: map[string]types.ActionData{
+			"run": {Command: "sh", Args: []string{"-c", slowStop}},
+		}},
+	}}}
+	var profile types.Profile
+	if err := yaml.Unmarshal([]byte("tasks: [{type: app, name: app, action: run}]"), &profile); err != nil {
+		t.Fatal(err)
+	}
+	return manager, config, profile
+}
+
+// waitForState polls the state of the only task until it is the expected one
+func waitForState(t *testing.T, manager *Manager, expected string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		states := manager.States()
+		// Running tasks are only ready once their process started
+		if len(states) == 1 && states[0].State == expected && (expected != RUNNING || states[0].PID != 0) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("task did not reach state %v: %+v", expected, manager.States())
+}
+
+func TestStopDoesNotBlockStates(t *testing.T) {
+	manager, config, profile := newTestManager(t)
+	if _, err := manager.Apply(config, profile); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.StopAll()
+	waitForState(t, manager, RUNNING)
+	// Gives the shell time to set up its trap
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan error)
+	go func() { stopped <- manager.Stop("app:run") }()
+	waitForState(t, manager, STOPPING)
+
+	start := time.Now()
+	if _, err := manager.Logs("app:run", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Start("app:run"); err == nil {
+		t.Error("a stopping task should not be started")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("reading the tasks took %v whilst stopping", elapsed)
+	}
+
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, manager, STOPPED)
+}
+
+func TestRestartWaitsForTheTaskToExit(t *testing.T) {
+	manager, config, profile := newTestManager(t)
+	if _, err := manager.Apply(config, profile); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.StopAll()
+	waitForState(t, manager, RUNNING)
+	time.Sleep(100 * time.Millisecond)
+	previous := manager.States()[0].PID
+
+	if err := manager.Restart("app:run"); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, manager, RUNNING)
+	state := manager.States()[0]
+	if state.PID == previous || state.Restarts != 1 {
+		t.Errorf("unexpected state after restarting: %+v", state)
+	}
+}
@@ -0,0 +1,19 @@
+package tui
+
+// ANSI sequences used to draw the screen
+const (
+	altScreenOn  = "\x1b[?1049h"
+	altScreenOff = "\x1b[?1049l"
+	cursorHide   = "\x1b[?25l"
+	cursorShow   = "\x1b[?25h"
+	cursorHome   = "\x1b[H"
+	clearLine    = "\x1b[K"
+	clearBelow   = "\x1b[J"
+	reset        = "\x1b[0m"
+	bold         = "\x1b[1m"
+	reverse      = "\x1b[7m"
+	red          = "\x1b[31m"
+	green        = "\x1b[32m"
+	yellow       = "\x1b[33m"
+	gray         = "\x1b[90m"
+)
@@ -0,0 +1,30 @@
+//go:build !unix
+
+package tui
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// Supported checks the terminal UI can be shown on this platform. The terminal settings are changed through
+// stty, which is only available on Unix
+func Supported() error {
+	return fmt.Errorf("the terminal UI is not supported on %v", runtime.GOOS)
+}
+
+type terminal struct{}
+
+func openTerminal() (*terminal, error) {
+	return nil, Supported()
+}
+
+func (t *terminal) restore() {}
+
+func (t *terminal) size() (int, int) {
+	return 24, 80
+}
+
+// notifyResize does nothing, as there is no resize signal
+func notifyResize(resized chan<- os.Signal) {}
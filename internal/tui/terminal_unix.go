@@ -0,0 +1,81 @@
+//go:build unix
+
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Supported checks the terminal UI can be shown on this platform
+func Supported() error {
+	return nil
+}
+
+// terminal switches the terminal to an alternate screen reading keys as soon as they are pressed. The terminal
+// settings are changed through stty, so no dependency is needed. Signals, like Ctrl+C, are still delivered
+type terminal struct {
+	// state holds the terminal settings to restore
+	state string
+}
+
+func openTerminal() (*terminal, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, fmt.Errorf("the terminal UI requires an interactive terminal")
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("failed reading terminal settings: %w", err)
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, fmt.Errorf("failed changing terminal settings: %w", err)
+	}
+	os.Stdout.WriteString(altScreenOn + cursorHide)
+	return &terminal{state: state}, nil
+}
+
+// restore goes back to the main screen and the original terminal settings
+func (t *terminal) restore() {
+	os.Stdout.WriteString(cursorShow + altScreenOff)
+	stty(t.state)
+}
+
+// size returns the number of rows and columns of the terminal
+func (t *terminal) size() (int, int) {
+	output, err := stty("size")
+	if err == nil {
+		if fields := strings.Fields(output); len(fields) == 2 {
+			rows, _ := strconv.Atoi(fields[0])
+			cols, _ := strconv.Atoi(fields[1])
+			if rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+	return 24, 80
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// notifyResize sends to the channel when the terminal is resized
+func notifyResize(resized chan<- os.Signal) {
+	signal.Notify(resized, syscall.SIGWINCH)
+}
@@ -0,0 +1,368 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+	"titan/internal/proxy"
+	"titan/internal/tasks"
+	"unicode/utf8"
+)
+
+// refreshInterval is how often the screen is redrawn when nothing happens
+const refreshInterval = 500 * time.Millisecond
+
+// TITAN is the entry of the tasks pane showing titan's own logs
+const TITAN = "titan"
+
+// Panes of the screen the selection can be moved on
+const (
+	tasksPane = iota
+	routesPane
+)
+
+// TUI is the terminal UI of serve. It lists the tasks of the profile and the routes, shows the logs of the
+// selected task and allows restarting or stopping tasks and toggling routes
+type TUI struct {
+	profile string
+	logs    *logWriter
+	proxy   *proxy.Proxy
+	tasks   *tasks.Manager
+
+	mu            sync.Mutex
+	focus         int
+	selectedTask  int
+	selectedRoute int
+	message       string
+}
+
+// New returns a TUI for the profile. Its LogOutput should be used for titan logs
+func New(profile string) *TUI {
+	return &TUI{profile: profile, logs: &logWriter{buffer: &tasks.LogBuffer{}}}
+}
+
+// LogOutput returns the writer titan logs have to be written to, so they are shown on the UI instead of
+// breaking it. They are written to stderr too whilst the UI is not shown
+func (t *TUI) LogOutput() io.Writer {
+	return t.logs
+}
+
+// Run shows the UI until the context is done. Quitting the UI calls cancel
+func (t *TUI) Run(ctx context.Context, cancel context.CancelFunc, proxy *proxy.Proxy, manager *tasks.Manager) error {
+	t.proxy, t.tasks = proxy, manager
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	t.logs.setActive(true)
+	defer func() {
+		term.restore()
+		t.logs.setActive(false)
+	}()
+
+	keys := make(chan []byte)
+	go readKeys(keys)
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer signal.Stop(resized)
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	rows, cols := term.size()
+	for {
+		t.draw(rows, cols)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-resized:
+			rows, cols = term.size()
+		case input := <-keys:
+			if t.handleKeys(input) {
+				cancel()
+				return nil
+			}
+		}
+	}
+}
+
+// readKeys sends what is typed to the channel. It reads until the process exits, as stdin cannot be interrupted
+func readKeys(keys chan<- []byte) {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		input := make([]byte, n)
+		copy(input, buf[:n])
+		keys <- input
+	}
+}
+
+// handleKeys applies the pressed keys. It returns true when quitting
+func (t *TUI) handleKeys(input []byte) bool {
+	for i := 0; i < len(input); i++ {
+		key := string(input[i])
+		// Arrow keys are sent as ESC [ A/B
+		if input[i] == 0x1b && i+2 < len(input) && input[i+1] == '[' {
+			key = map[byte]string{'A': "up", 'B': "down"}[input[i+2]]
+			i += 2
+		}
+		switch key {
+		case "q":
+			return true
+		case "up", "k":
+			t.move(-1)
+		case "down", "j":
+			t.move(1)
+		case "\t":
+			t.mu.Lock()
+			t.focus = (t.focus + 1) % 2
+			t.mu.Unlock()
+		case "r":
+			t.taskAction("restart")
+		case "s":
+			t.taskAction("toggle")
+		case " ", "\r", "\n":
+			t.toggleRoute()
+		}
+	}
+	return false
+}
+
+func (t *TUI) move(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.focus == tasksPane {
+		t.selectedTask = clamp(t.selectedTask+delta, len(t.tasks.States()))
+	} else {
+		t.selectedRoute = clamp(t.selectedRoute+delta, len(t.proxy.Routes())-1)
+	}
+}
+
+// selectedTaskState returns the state of the selected task, nil when titan logs are selected
+func (t *TUI) selectedTaskState() *tasks.State {
+	states := t.tasks.States()
+	if t.selectedTask == 0 || t.selectedTask > len(states) {
+		return nil
+	}
+	return &states[t.selectedTask-1]
+}
+
+func (t *TUI) taskAction(action string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.focus != tasksPane {
+		return
+	}
+	state := t.selectedTaskState()
+	if state == nil {
+		return
+	}
+	name := state.Name
+	if action == "toggle" {
+		action = "start"
+		if state.State == tasks.RUNNING {
+			action = "stop"
+		}
+	}
+	t.message = fmt.Sprintf("%v %v...", action, name)
+	// Stopping waits for the task to exit, so the UI is not blocked meanwhile
+	go func() {
+		var err error
+		switch action {
+		case "restart":
+			err = t.tasks.Restart(name)
+		case "stop":
+			err = t.tasks.Stop(name)
+		case "start":
+			err = t.tasks.Start(name)
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.message = fmt.Sprintf("%v %v done", action, name)
+		if err != nil {
+			t.message = err.Error()
+		}
+	}()
+}
+
+func (t *TUI) toggleRoute() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	routes := t.proxy.Routes()
+	if t.focus != routesPane || t.selectedRoute >= len(routes) {
+		return
+	}
+	route := routes[t.selectedRoute]
+	if err := t.proxy.SetRouteEnabled(route.Name, route.Disabled); err != nil {
+		t.message = err.Error()
+		return
+	}
+	t.message = fmt.Sprintf("route %v enabled", route.Name)
+	if !route.Disabled {
+		t.message = fmt.Sprintf("route %v disabled", route.Name)
+	}
+}
+
+// draw renders the whole screen
+func (t *TUI) draw(rows int, cols int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	states := t.tasks.States()
+	routes := t.proxy.Routes()
+	t.selectedTask = clamp(t.selectedTask, len(states))
+	t.selectedRoute = clamp(t.selectedRoute, len(routes)-1)
+
+	leftWidth := min(40, cols/3)
+	bodyRows := max(rows-2, 1)
+
+	// Left pane: tasks, titan logs first, and routes
+	var left []string
+	left = append(left, heading("TASKS", t.focus == tasksPane))
+	left = append(left, t.listItem(t.selectedTask == 0, t.focus == tasksPane, "", TITAN, "logs", leftWidth))
+	for i, state := range states {
+		left = append(left, t.listItem(t.selectedTask == i+1, t.focus == tasksPane, stateColor(state.State), state.Name, state.State, leftWidth))
+	}
+	left = append(left, "", heading("ROUTES", t.focus == routesPane))
+	for i, route := range routes {
+		color, status := green, "on"
+		if route.Disabled {
+			color, status = gray, "off"
+		} else if route.Health == proxy.UNHEALTHY {
+			color, status = red, "down"
+		}
+		left = append(left, t.listItem(t.selectedRoute == i, t.focus == routesPane, color, fmt.Sprintf("%v %v", route.Name, route.Source), status, leftWidth))
+	}
+
+	// Right pane: logs of the selected task
+	logsName := TITAN
+	var lines []string
+	if state := t.selectedTaskState(); state != nil {
+		logsName = state.Name
+		lines, _ = t.tasks.Logs(state.Name, bodyRows-1)
+	} else {
+		lines = t.logs.buffer.Tail(bodyRows - 1)
+	}
+	right := append([]string{heading("LOGS "+logsName, false)}, lines...)
+
+	var sb strings.Builder
+	sb.WriteString(cursorHome)
+	sb.WriteString(reverse + pad(fmt.Sprintf(" titan serve - profile %v", t.profile), cols) + reset + clearLine + "\r\n")
+	for row := range bodyRows {
+		var leftCell, rightCell string
+		if row < len(left) {
+			leftCell = left[row]
+		}
+		if row < len(right) {
+			rightCell = right[row]
+			if row > 0 {
+				rightCell = truncate(tasks.StripANSI(rightCell), cols-leftWidth-3)
+			}
+		}
+		sb.WriteString(leftCell + strings.Repeat(" ", max(leftWidth-visibleWidth(leftCell), 0)) + gray + " │ " + reset + rightCell + clearLine + "\r\n")
+	}
+	sb.WriteString(reverse + pad(t.statusBar(), cols) + reset + clearLine + clearBelow)
+	os.Stdout.WriteString(sb.String())
+}
+
+// listItem renders an entry of the left pane, with its status right aligned
+func (t *TUI) listItem(selected bool, focused bool, color string, name string, status string, width int) string {
+	marker := "  "
+	if selected {
+		marker = "> "
+	}
+	name = truncate(name, width-len(marker)-len(status)-3)
+	spaces := strings.Repeat(" ", max(width-len(marker)-utf8.RuneCountInString(name)-len(status)-2, 1))
+	item := marker + name + spaces + color + "● " + status + reset
+	if selected && focused {
+		item = bold + item
+	}
+	return item
+}
+
+func (t *TUI) statusBar() string {
+	snapshot := t.proxy.Metrics().Snapshot()
+	var errors int64
+	for _, route := range snapshot.Routes {
+		errors += route.Errors
+	}
+	status := fmt.Sprintf(" %d requests  %d in flight  %d 5xx │ ", snapshot.Requests, snapshot.InFlight, errors)
+	if t.message != "" {
+		status += t.message + " │ "
+	}
+	return status + "↑↓ select  tab pane  r restart  s stop/start  space toggle route  q quit"
+}
+
+func heading(title string, focused bool) string {
+	if focused {
+		return bold + yellow + title + reset
+	}
+	return bold + title + reset
+}
+
+func stateColor(state string) string {
+	switch state {
+	case tasks.RUNNING:
+		return green
+	case tasks.FAILED:
+		return red
+	case tasks.STOPPING:
+		return yellow
+	}
+	return gray
+}
+
+// visibleWidth returns the number of characters shown for the text, ignoring the escape sequences
+func visibleWidth(text string) int {
+	return utf8.RuneCountInString(tasks.StripANSI(text))
+}
+
+func truncate(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:max(width-1, 0)]) + "…"
+}
+
+func pad(text string, width int) string {
+	text = truncate(text, width)
+	return text + strings.Repeat(" ", max(width-utf8.RuneCountInString(text), 0))
+}
+
+func clamp(value int, maximum int) int {
+	return max(0, min(value, maximum))
+}
+
+// logWriter keeps titan logs to show them on the UI, writing them to stderr too whilst the UI is not active
+type logWriter struct {
+	mu     sync.Mutex
+	buffer *tasks.LogBuffer
+	active bool
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.active {
+		os.Stderr.Write(p)
+	}
+	return w.buffer.Write(p)
+}
+
+func (w *logWriter) setActive(active bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.active = active
+}
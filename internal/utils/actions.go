@@ -8,5 +8,12 @@ const (
 	INSTALL      types.Action = "install"
 	BUILD        types.Action = "build"
 	REPO_ALL     types.Action = "all"
+	STATUS       types.Action = "status"
+	CLONE        types.Action = "clone"
+	BOOTSTRAP    types.Action = "bootstrap"
+	CHECKOUT     types.Action = "checkout"
+	HISTORY      types.Action = "history"
+	VALIDATE     types.Action = "validate"
+	CERTS        types.Action = "certs"
 	PROXY_SERVER types.Action = "proxy-server"
 )
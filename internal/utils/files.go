@@ -27,7 +27,8 @@ func CreateTempFile(dir string, namePattern string, fileContents string) (*os.Fi
 	return tmpFile, nil
 }
 
-func getPathWithUserHome(dir string) string {
+// PathWithUserHome expands a leading "~" in the given path to the user home directory
+func PathWithUserHome(dir string) string {
 	if strings.HasPrefix(dir, "~") {
 		home, _ := os.UserHomeDir()
 		return home + strings.TrimPrefix(dir, "~")
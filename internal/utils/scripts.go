@@ -1,11 +1,14 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 	"titan/pkg/types"
 )
 
@@ -37,8 +40,9 @@ func CaptureEnvironment(versions types.Versions) ([]string, error) {
 	return env, nil
 }
 
-// ExecScript is a utility function that creates a shell script and executes it
-func ExecScript(script string, env []string, dir string) error {
+// ExecScript is a utility function that creates a shell script and executes it. The script output is
+// written to the given writer, or to stdout when nil
+func ExecScript(script string, env []string, dir string, output io.Writer) error {
 	// Write script to temp file
 	tmpFile, err := CreateTempFile("", "titan-action-*.sh", script)
 	if err != nil {
@@ -48,6 +52,7 @@ func ExecScript(script string, env []string, dir string) error {
 
 	// Execute the script
 	options := NewExecCommandOptions(env, dir, "bash", tmpFile.Name())
+	options.Output = output
 	return ExecCommand(options)
 }
 
@@ -57,6 +62,12 @@ type ExecCommandOptions struct {
 	Dir     string
 	Command string
 	Args    []string
+	// Output is where the command output is streamed to. Defaults to stdout
+	Output io.Writer
+	// Context stops the command, and any process it started, when done. Optional
+	Context context.Context
+	// Started is called with the process ID once the command starts. Optional
+	Started func(pid int)
 }
 
 // NewExecCommandOptions returns an ExecCommandOptions struct
@@ -71,25 +82,61 @@ func NewExecCommandOptions(env []string, dir string, command string, args ...str
 
 // ExecCommand is a utility function that executes simple shell commands
 func ExecCommand(options ExecCommandOptions) error {
-	workingDir := getPathWithUserHome(options.Dir)
+	workingDir := PathWithUserHome(options.Dir)
 	cmd := exec.Command(options.Command, options.Args...)
+	if options.Context != nil {
+		cmd = exec.CommandContext(options.Context, options.Command, options.Args...)
+		stopProcessTree(cmd)
+		cmd.WaitDelay = 10 * time.Second
+	}
 	cmd.Dir = workingDir
 	cmd.Env = options.Env
-	cmd.Stderr = cmd.Stdout // redirect stderr to stdout
 	// using pipes should be quicker than capturing the full output with cmd.Output()
 	stdoutPipe, _ := cmd.StdoutPipe()
+	cmd.Stderr = cmd.Stdout // redirect stderr to stdout
+
+	output := options.Output
+	if output == nil {
+		output = os.Stdout
+	}
 
 	if err := cmd.Start(); err != nil {
 		return err
 	}
+	if options.Started != nil {
+		options.Started(cmd.Process.Pid)
+	}
 
-	// Stream output directly to stdout
+	// Stream output directly to the output. All of it must be read before waiting for the command
+	copied := make(chan struct{})
 	go func() {
-		_, _ = io.Copy(os.Stdout, stdoutPipe)
+		_, _ = io.Copy(output, stdoutPipe)
+		close(copied)
 	}()
+	<-copied
 
 	if err := cmd.Wait(); err != nil {
 		return err
 	}
 	return nil
 }
+
+// ExecCommandOutput is a utility function that executes simple shell commands and returns their output
+// instead of streaming it
+func ExecCommandOutput(options ExecCommandOptions) (string, error) {
+	workingDir := PathWithUserHome(options.Dir)
+	cmd := exec.Command(options.Command, options.Args...)
+	cmd.Dir = workingDir
+	cmd.Env = options.Env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package utils
+
+import "os/exec"
+
+// stopProcessTree keeps the default behaviour of killing only the command, as there is no way to reach the
+// processes it started
+func stopProcessTree(cmd *exec.Cmd) {}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package utils
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// stopProcessTree stops the command along with the processes it started when its context is done. Windows has
+// no process groups to signal, so the whole tree is killed with taskkill, falling back to killing the command
+func stopProcessTree(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"titan/pkg/types"
+)
+
+// repoActionNames are the repository actions that can be configured
+var repoActionNames = []string{"fetch", "install", "build", "clean"}
+
+// Validate checks the configuration for missing or inconsistent values. It returns all the issues found
+func Validate(config *types.Config) []error {
+	var issues []error
+	addIssue := func(format string, args ...any) {
+		issues = append(issues, fmt.Errorf(format, args...))
+	}
+
+	if config.Versions.Node == "" {
+		addIssue("versions.node is required")
+	}
+	if config.Versions.PNPM == "" {
+		addIssue("versions.pnpm is required")
+	}
+
+	for _, name := range sortedKeys(config.RepoActions.Repositories) {
+		if config.RepoActions.Repositories[name].Path == "" {
+			addIssue("repo-actions.repositories.%v: path is required", name)
+		}
+	}
+	for _, name := range sortedKeys(config.RepoActions.Actions) {
+		if !slices.Contains(repoActionNames, name) {
+			addIssue("repo-actions.actions.%v: unknown action, valid ones are %v", name, strings.Join(repoActionNames, ", "))
+			continue
+		}
+		action := config.RepoActions.Actions[name]
+		if action == nil {
+			continue
+		}
+		if action.Mode != "" && (action.Mode != "git" || name != "fetch") {
+			addIssue("repo-actions.actions.%v: mode %q is not available for this action", name, action.Mode)
+		}
+		if action.Cache != nil && name != "install" && name != "build" {
+			addIssue("repo-actions.actions.%v: cache is only available for install and build", name)
+		}
+	}
+
+	if !slices.Contains([]string{"", "debug", "info", "warn", "warning", "error"}, strings.ToLower(config.Logging.Level)) {
+		addIssue("logging.level: invalid level %q", config.Logging.Level)
+	}
+	if !slices.Contains([]string{"", "text", "json", "pretty"}, config.Logging.Format) {
+		addIssue("logging.format: invalid format %q", config.Logging.Format)
+	}
+
+	server := config.Server
+	if (server.SSL.Cert == "") != (server.SSL.Key == "") {
+		addIssue("server.ssl: cert and key must be provided together")
+	}
+	if server.SSL.Auto && (server.SSL.Cert != "" || server.SSL.Key != "") {
+		addIssue("server.ssl: auto cannot be used together with cert and key")
+	}
+	if len(server.SSL.SANs) > 0 && !server.SSL.Auto {
+		addIssue("server.ssl.sans: only used when auto is enabled")
+	}
+	switch server.SSL.Mode {
+	case "", "http":
+	case "https", "both", "redirect":
+		if !server.SSL.Auto && (server.SSL.Cert == "" || server.SSL.Key == "") {
+			addIssue("server.ssl: mode %q requires cert and key, or auto", server.SSL.Mode)
+		}
+	default:
+		addIssue("server.ssl.mode: invalid mode %q", server.SSL.Mode)
+	}
+	if server.Admin.Port < 0 || server.Admin.Port > 65535 {
+		addIssue("server.admin.port: invalid port %d", server.Admin.Port)
+	}
+	if server.Admin.Host != "" && server.Admin.Port == 0 {
+		addIssue("server.admin: port is required to start the admin server")
+	}
+	if server.Admin.Port != 0 && server.Admin.Port == server.Port {
+		addIssue("server.admin.port: must be different from server.port")
+	}
+	if server.Metrics.Port < 0 || server.Metrics.Port > 65535 {
+		addIssue("server.metrics.port: invalid port %d", server.Metrics.Port)
+	}
+	if (server.Metrics.Host != "" || server.Metrics.Path != "") && server.Metrics.Port == 0 {
+		addIssue("server.metrics: port is required to start the metrics server")
+	}
+	if server.Metrics.Port != 0 && (server.Metrics.Port == server.Port || server.Metrics.Port == server.Admin.Port) {
+		addIssue("server.metrics.port: must be different from server.port and server.admin.port")
+	}
+	if server.Metrics.Path != "" && !strings.HasPrefix(server.Metrics.Path, "/") {
+		addIssue("server.metrics.path: must start with /")
+	}
+	if !slices.Contains([]string{"", "common", "combined", "json"}, server.AccessLog.Format) {
+		addIssue("server.access-log.format: invalid format %q", server.AccessLog.Format)
+	}
+	for _, name := range sortedKeys(server.Routes) {
+		route := server.Routes[name]
+		if !strings.HasPrefix(route.Source, "/") {
+			addIssue("server.routes.%v: source must start with \"/\"", name)
+		}
+		switch {
+		case route.Mock != nil:
+			if route.Target != "" || len(route.Targets) > 0 || route.Static != nil {
+				addIssue("server.routes.%v: mock cannot be used together with target, targets or static", name)
+			}
+			if route.Health != (types.HealthCheck{}) {
+				addIssue("server.routes.%v.health: not available for mock routes", name)
+			}
+			for i, response := range route.Mock.Responses {
+				if response.Path != "" && !strings.HasPrefix(response.Path, "/") {
+					addIssue("server.routes.%v.mock.responses[%d].path: must start with /", name, i)
+				}
+				if response.Status != 0 && (response.Status < 100 || response.Status > 599) {
+					addIssue("server.routes.%v.mock.responses[%d].status: invalid status %d", name, i, response.Status)
+				}
+				if response.ErrorStatus != 0 && (response.ErrorStatus < 100 || response.ErrorStatus > 599) {
+					addIssue("server.routes.%v.mock.responses[%d].error-status: invalid status %d", name, i, response.ErrorStatus)
+				}
+				if response.Body != nil && response.File != "" {
+					addIssue("server.routes.%v.mock.responses[%d]: body and file cannot be used together", name, i)
+				}
+				if response.ErrorRate < 0 || response.ErrorRate > 1 {
+					addIssue("server.routes.%v.mock.responses[%d].error-rate: must be between 0 and 1", name, i)
+				}
+				if response.Latency < 0 {
+					addIssue("server.routes.%v.mock.responses[%d].latency: cannot be negative", name, i)
+				}
+			}
+		case route.Static != nil:
+			if route.Target != "" || len(route.Targets) > 0 {
+				addIssue("server.routes.%v: static cannot be used together with target or targets", name)
+			}
+			if route.Static.Dir == "" {
+				addIssue("server.routes.%v.static: dir is required", name)
+			}
+			if route.Health != (types.HealthCheck{}) {
+				addIssue("server.routes.%v.health: not available for static routes", name)
+			}
+		case route.Target != "" && len(route.Targets) > 0:
+			addIssue("server.routes.%v: target and targets cannot be used together", name)
+		case route.Target != "":
+			if !isAbsoluteURL(route.Target) {
+				addIssue("server.routes.%v: target %q must be an absolute URL", name, route.Target)
+			}
+		case len(route.Targets) > 0:
+			for i, target := range route.Targets {
+				if !isAbsoluteURL(target) {
+					addIssue("server.routes.%v.targets[%d]: target %q must be an absolute URL", name, i, target)
+				}
+			}
+		case route.Replay == nil:
+			addIssue("server.routes.%v: target, targets, static, mock or replay is required", name)
+		}
+		if route.Balance != (types.Balance{}) && len(route.Targets) < 2 {
+			addIssue("server.routes.%v.balance: only used with several targets", name)
+		}
+		if !slices.Contains([]string{"", "round-robin", "least-connections", "random"}, route.Balance.Strategy) {
+			addIssue("server.routes.%v.balance.strategy: invalid strategy %q", name, route.Balance.Strategy)
+		}
+		if route.Balance.EjectAfter < 0 || route.Balance.EjectFor < 0 {
+			addIssue("server.routes.%v.balance: eject-after and eject-for cannot be negative", name)
+		}
+		for i, rule := range route.Rewrite {
+			if _, err := regexp.Compile(rule.Match); err != nil {
+				addIssue("server.routes.%v.rewrite[%d]: invalid expression: %v", name, i, err)
+			}
+		}
+		if route.Health.Path != "" && !strings.HasPrefix(route.Health.Path, "/") {
+			addIssue("server.routes.%v.health.path: must start with /", name)
+		}
+		if route.Health.Interval < 0 || route.Health.Timeout < 0 || route.Health.Wait < 0 {
+			addIssue("server.routes.%v.health: durations cannot be negative", name)
+		}
+		if route.CORS != nil && len(route.CORS.AllowOrigins) == 0 {
+			addIssue("server.routes.%v.cors: allow-origins is required", name)
+		}
+		if route.CORS != nil && route.CORS.MaxAge < 0 {
+			addIssue("server.routes.%v.cors.max-age: cannot be negative", name)
+		}
+		if route.Record != nil {
+			if route.Record.File == "" {
+				addIssue("server.routes.%v.record: file is required", name)
+			}
+			if !slices.Contains([]string{"", "jsonl", "har"}, route.Record.Format) {
+				addIssue("server.routes.%v.record.format: invalid format %q", name, route.Record.Format)
+			}
+			if route.Record.MaxBodySize < 0 {
+				addIssue("server.routes.%v.record.max-body-size: cannot be negative", name)
+			}
+			if route.Target == "" && len(route.Targets) == 0 && route.Static == nil && route.Mock == nil {
+				addIssue("server.routes.%v.record: target, targets, static or mock is required to record", name)
+			}
+		}
+		if route.Replay != nil {
+			if route.Replay.File == "" {
+				addIssue("server.routes.%v.replay: file is required", name)
+			}
+			for i, part := range route.Replay.Match {
+				if !slices.Contains([]string{"method", "path", "query", "body"}, part) {
+					addIssue("server.routes.%v.replay.match[%d]: invalid part %q", name, i, part)
+				}
+			}
+		}
+		for i, fault := range route.Faults {
+			for _, issue := range ValidateFault(fault) {
+				addIssue("server.routes.%v.faults[%d]%v", name, i, issue)
+			}
+		}
+		if route.Task != "" {
+			appName, action, hasAction := strings.Cut(route.Task, ":")
+			app, found := server.Applications[appName]
+			if !found {
+				addIssue("server.routes.%v.task: application [%v] not found", name, appName)
+			} else if _, found := app.Actions[action]; hasAction && !found {
+				addIssue("server.routes.%v.task: action [%v] not found in application [%v]", name, action, appName)
+			}
+		}
+	}
+	for _, name := range sortedKeys(server.Profiles) {
+		profile := server.Profiles[name]
+		for i, task := range profile.Tasks {
+			app, found := server.Applications[task.Name]
+			if !found {
+				addIssue("server.profiles.%v.tasks[%d]: application [%v] not found", name, i, task.Name)
+				continue
+			}
+			if _, found := app.Actions[task.Action]; !found {
+				addIssue("server.profiles.%v.tasks[%d]: action [%v] not found in application [%v]", name, i, task.Action, task.Name)
+			}
+		}
+		for _, route := range profile.Routes {
+			if _, found := server.Routes[route]; !found {
+				addIssue("server.profiles.%v.routes: route [%v] not found", name, route)
+			}
+		}
+	}
+
+	return issues
+}
+
+// ValidateFault checks the values of a fault injected into a route, also when set while running. The issues
+// start with the field they refer to, if any
+func ValidateFault(fault types.Fault) []error {
+	var issues []error
+	addIssue := func(format string, args ...any) {
+		issues = append(issues, fmt.Errorf(format, args...))
+	}
+	if fault.Path != "" && !strings.HasPrefix(fault.Path, "/") {
+		addIssue(".path: must start with /")
+	}
+	if fault.Latency < 0 || fault.Jitter < 0 {
+		addIssue(": latency and jitter cannot be negative")
+	}
+	if fault.Bandwidth < 0 {
+		addIssue(".bandwidth: cannot be negative")
+	}
+	if fault.ErrorRate < 0 || fault.ErrorRate > 1 {
+		addIssue(".error-rate: must be between 0 and 1")
+	}
+	if fault.ResetRate < 0 || fault.ResetRate > 1 {
+		addIssue(".reset-rate: must be between 0 and 1")
+	}
+	if fault.ErrorStatus != 0 && (fault.ErrorStatus < 100 || fault.ErrorStatus > 599) {
+		addIssue(".error-status: invalid status %d", fault.ErrorStatus)
+	}
+	return issues
+}
+
+func isAbsoluteURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && parsed.Scheme != "" && parsed.Host != ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
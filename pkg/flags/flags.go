@@ -3,8 +3,11 @@ package flags
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 	"titan/internal/utils"
+	"titan/pkg/types"
 )
 
 type Command struct {
@@ -12,17 +15,79 @@ type Command struct {
 	Subcommand []Command
 }
 
+// RepoFlags holds the flags available to the repository commands
+type RepoFlags struct {
+	// AutoStash allows pulling on repositories with local changes
+	AutoStash bool
+	// Jobs limits how many repositories are processed at the same time. 0 means no limit
+	Jobs int
+	// Only restricts the command to the given repository names
+	Only []string
+	// Branch to switch the repositories to
+	Branch string
+	// Create creates the branch on the repositories where it does not exist
+	Create bool
+	// Force runs the actions even if their cached inputs did not change
+	Force bool
+	// Output is the format of the command output: text, json or ndjson
+	Output string
+}
+
+// ServeFlags holds the flags available to the serve command, besides the profile
+type ServeFlags struct {
+	// Output is the format of the command output: text, json or ndjson
+	Output string
+	// Watch reloads the configuration file when it changes
+	Watch bool
+	// TUI shows an interactive terminal UI instead of the logs
+	TUI bool
+}
+
+// ValidateFlags holds the flags available to the validate command
+type ValidateFlags struct {
+	// Output is the format of the command output: text, json or ndjson
+	Output string
+}
+
+// CertsFlags holds the flags available to the certs command
+type CertsFlags struct {
+	// Export copies the local CA certificate to the given path
+	Export string
+	// Renew issues the certificate even if the current one is still valid
+	Renew bool
+}
+
+// HistoryFlags holds the flags available to the history command
+type HistoryFlags struct {
+	// Failed lists only the runs where some action failed
+	Failed bool
+	// Limit is the maximum number of runs listed
+	Limit int
+	// Run shows the actions of the run with the given ID
+	Run string
+	// Compare compares the durations of the latest run of the command with the previous ones
+	Compare string
+}
+
 type AppCommands struct {
 	commands map[string]Command
+	logging  *types.Logging
 }
 
 type AppCommandsOptions struct {
 	Commands map[string]Command
+	// Logging is filled with the logging flags before running the command
+	Logging *types.Logging
 }
 
 func NewAppCommands(options *AppCommandsOptions) *AppCommands {
+	logging := options.Logging
+	if logging == nil {
+		logging = &types.Logging{}
+	}
 	return &AppCommands{
 		commands: options.Commands,
+		logging:  logging,
 	}
 }
 
@@ -30,22 +95,77 @@ func (ac *AppCommands) Run() error {
 	// String that contains the configured configuration path
 	var configPath string
 	flag.StringVar(&configPath, "c", "./titan.yaml", "path to config file")
+	// Logging flags. When empty the values from the config file are used
+	flag.StringVar(&ac.logging.Level, "log-level", "", "minimum level logged: debug, info, warn or error")
+	flag.StringVar(&ac.logging.Format, "log-format", "", "format of the logs: text, json or pretty")
+	flag.StringVar(&ac.logging.File, "log-file", "", "file to append the logs to instead of stderr")
+
+	// Flags shared by the repository commands
+	var repoFlags RepoFlags
+	// Clone and bootstrap limit the jobs by default, so they are kept apart to not limit the other commands
+	var cloneJobs int
 
 	// Define subcommands
 	fetchCmd := flag.NewFlagSet("fetch", flag.ExitOnError)
 	registerGlobalFlags(fetchCmd)
+	registerRepoFlags(fetchCmd, &repoFlags)
+	fetchCmd.BoolVar(&repoFlags.AutoStash, "autostash", false, "stash local changes before pulling and restore them afterwards")
 	installCmd := flag.NewFlagSet("install", flag.ExitOnError)
 	registerGlobalFlags(installCmd)
+	registerRepoFlags(installCmd, &repoFlags)
+	installCmd.BoolVar(&repoFlags.Force, "force", false, "run the actions even if their cached inputs did not change")
 	buildCmd := flag.NewFlagSet("build", flag.ExitOnError)
 	registerGlobalFlags(buildCmd)
+	registerRepoFlags(buildCmd, &repoFlags)
+	buildCmd.BoolVar(&repoFlags.Force, "force", false, "run the actions even if their cached inputs did not change")
 	cleanCmd := flag.NewFlagSet("clean", flag.ExitOnError)
 	registerGlobalFlags(cleanCmd)
+	registerRepoFlags(cleanCmd, &repoFlags)
 	allCmd := flag.NewFlagSet("all", flag.ExitOnError)
 	registerGlobalFlags(allCmd)
+	registerRepoFlags(allCmd, &repoFlags)
+	allCmd.BoolVar(&repoFlags.Force, "force", false, "run the actions even if their cached inputs did not change")
+	allCmd.BoolVar(&repoFlags.AutoStash, "autostash", false, "stash local changes before pulling and restore them afterwards")
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	registerGlobalFlags(statusCmd)
+	registerRepoFlags(statusCmd, &repoFlags)
+	cloneCmd := flag.NewFlagSet("clone", flag.ExitOnError)
+	registerGlobalFlags(cloneCmd)
+	registerRepoFlags(cloneCmd, &repoFlags)
+	cloneCmd.IntVar(&cloneJobs, "jobs", 4, "maximum number of repositories cloned at the same time")
+	bootstrapCmd := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	registerGlobalFlags(bootstrapCmd)
+	registerRepoFlags(bootstrapCmd, &repoFlags)
+	bootstrapCmd.BoolVar(&repoFlags.Force, "force", false, "run the actions even if their cached inputs did not change")
+	bootstrapCmd.IntVar(&cloneJobs, "jobs", 4, "maximum number of repositories cloned and installed at the same time")
+	checkoutCmd := flag.NewFlagSet("checkout", flag.ExitOnError)
+	registerGlobalFlags(checkoutCmd)
+	registerRepoFlags(checkoutCmd, &repoFlags)
+	checkoutCmd.BoolVar(&repoFlags.Create, "create", false, "create the branch on the repositories where it does not exist")
+	var historyFlags HistoryFlags
+	historyCmd := flag.NewFlagSet("history", flag.ExitOnError)
+	registerGlobalFlags(historyCmd)
+	historyCmd.BoolVar(&historyFlags.Failed, "failed", false, "list only the runs where some action failed")
+	historyCmd.IntVar(&historyFlags.Limit, "limit", 20, "maximum number of runs to list")
+	historyCmd.StringVar(&historyFlags.Run, "run", "", "show the actions of the run with the given ID")
+	historyCmd.StringVar(&historyFlags.Compare, "compare", "", "compare the durations of the latest run of the given command with the previous ones")
 	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 	registerGlobalFlags(serveCmd)
 	var profile string
 	serveCmd.StringVar(&profile, "p", "", "profile to use")
+	var serveFlags ServeFlags
+	registerOutputFlag(serveCmd, &serveFlags.Output)
+	serveCmd.BoolVar(&serveFlags.Watch, "watch", true, "reload the configuration file when it changes")
+	serveCmd.BoolVar(&serveFlags.TUI, "tui", false, "show an interactive terminal UI with the tasks, their logs and the routes")
+	var validateFlags ValidateFlags
+	validateCmd := flag.NewFlagSet("validate", flag.ExitOnError)
+	registerGlobalFlags(validateCmd)
+	registerOutputFlag(validateCmd, &validateFlags.Output)
+	var certsFlags CertsFlags
+	certsCmd := flag.NewFlagSet("certs", flag.ExitOnError)
+	registerGlobalFlags(certsCmd)
+	certsCmd.StringVar(&certsFlags.Export, "export", "", "copy the local CA certificate to the given path")
+	certsCmd.BoolVar(&certsFlags.Renew, "renew", false, "issue the certificate even if the current one is still valid")
 	helpCmd := flag.NewFlagSet("help", flag.ExitOnError)
 	registerGlobalFlags(helpCmd)
 
@@ -66,32 +186,58 @@ func (ac *AppCommands) Run() error {
 		}
 
 		if command, ok := ac.commands[name]; ok {
-			command.Runner(vars...)
-		} else {
-			return errors.New("No command runner found for fetch")
+			return command.Runner(vars...)
 		}
-		return nil
+		return fmt.Errorf("No command runner found for %v", name)
 	}
 	// Parse flags based on command
 	switch os.Args[1] {
 	case "fetch":
 		fetchCmd.Parse(os.Args[2:])
-		return runCommand("fetch", configPath)
+		return runCommand("fetch", configPath, repoFlags)
 	case "install":
 		installCmd.Parse(os.Args[2:])
-		return runCommand("install", configPath)
+		return runCommand("install", configPath, repoFlags)
 	case "build":
 		buildCmd.Parse(os.Args[2:])
-		return runCommand("build", configPath)
+		return runCommand("build", configPath, repoFlags)
 	case "clean":
 		cleanCmd.Parse(os.Args[2:])
-		return runCommand("clean", configPath)
+		return runCommand("clean", configPath, repoFlags)
 	case "all":
 		allCmd.Parse(os.Args[2:])
-		return runCommand("all", configPath)
+		return runCommand("all", configPath, repoFlags)
+	case "status":
+		statusCmd.Parse(os.Args[2:])
+		return runCommand("status", configPath, repoFlags)
+	case "clone":
+		cloneCmd.Parse(os.Args[2:])
+		repoFlags.Jobs = cloneJobs
+		return runCommand("clone", configPath, repoFlags)
+	case "bootstrap":
+		bootstrapCmd.Parse(os.Args[2:])
+		repoFlags.Jobs = cloneJobs
+		return runCommand("bootstrap", configPath, repoFlags)
+	case "checkout":
+		// The branch comes first so the flags are parsed after it
+		if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
+			return errors.New("missing branch to checkout")
+		}
+		repoFlags.Branch = os.Args[2]
+		checkoutCmd.Parse(os.Args[3:])
+		return runCommand("checkout", configPath, repoFlags)
+	case "history":
+		historyCmd.Parse(os.Args[2:])
+		return runCommand("history", configPath, historyFlags)
 	case "serve":
 		serveCmd.Parse(os.Args[2:])
-		return runCommand("serve", configPath, profile)
+		return runCommand("serve", configPath, profile, serveFlags)
+	case "validate":
+		validateCmd.Parse(os.Args[2:])
+		return runCommand("validate", configPath, validateFlags)
+	case "certs":
+		certsCmd.Parse(os.Args[2:])
+		return runCommand("certs", configPath, certsFlags)
 	case "help":
 		helpCmd.Parse(os.Args[2:])
 		return runCommand("help")
@@ -100,6 +246,22 @@ func (ac *AppCommands) Run() error {
 	}
 }
 
+func registerRepoFlags(fset *flag.FlagSet, repoFlags *RepoFlags) {
+	fset.Func("only", "comma separated list of repositories to run the command on", func(value string) error {
+		for name := range strings.SplitSeq(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				repoFlags.Only = append(repoFlags.Only, name)
+			}
+		}
+		return nil
+	})
+	registerOutputFlag(fset, &repoFlags.Output)
+}
+
+func registerOutputFlag(fset *flag.FlagSet, output *string) {
+	fset.StringVar(output, "output", "text", "format of the output: text, json or ndjson")
+}
+
 func registerGlobalFlags(fset *flag.FlagSet) {
 	flag.VisitAll(func(f *flag.Flag) {
 		fset.Var(f.Value, f.Name, f.Usage)
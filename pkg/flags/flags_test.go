@@ -0,0 +1,62 @@
+package flags
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// runRepoCommand runs the command line given, returning the flags the repository command got
+func runRepoCommand(t *testing.T, args ...string) RepoFlags {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "titan.yaml")
+	if err := os.WriteFile(configPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The global flags are registered on every run
+	commandLine, osArgs := flag.CommandLine, os.Args
+	defer func() { flag.CommandLine, os.Args = commandLine, osArgs }()
+	flag.CommandLine = flag.NewFlagSet(args[0], flag.ExitOnError)
+	os.Args = append(append([]string{"titan"}, args...), "-c", configPath)
+
+	var got RepoFlags
+	runner := func(vars ...any) error {
+		got = vars[1].(RepoFlags)
+		return nil
+	}
+	commands := map[string]Command{}
+	for _, name := range []string{"fetch", "install", "build", "clean", "all", "status", "clone", "bootstrap", "checkout"} {
+		commands[name] = Command{Runner: runner}
+	}
+	if err := NewAppCommands(&AppCommandsOptions{Commands: commands}).Run(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestJobs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"fetch"}, 0},
+		{[]string{"install"}, 0},
+		{[]string{"build"}, 0},
+		{[]string{"all"}, 0},
+		{[]string{"status"}, 0},
+		{[]string{"checkout", "main"}, 0},
+		{[]string{"clone"}, 4},
+		{[]string{"clone", "-jobs", "2"}, 2},
+		{[]string{"bootstrap"}, 4},
+		{[]string{"bootstrap", "-jobs", "0"}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.args[0], func(t *testing.T) {
+			if got := runRepoCommand(t, test.args...).Jobs; got != test.want {
+				t.Errorf("%v got %d jobs, want %d", test.args, got, test.want)
+			}
+		})
+	}
+}
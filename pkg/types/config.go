@@ -1,5 +1,11 @@
 package types
 
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 type ActionData struct {
 	Command string   `yaml:"command"`
 	Args    []string `yaml:"args"`
@@ -21,23 +27,333 @@ type Profile struct {
 	Routes []string `yaml:"routes"`
 }
 
+// Route holds the configuration of a proxied route
+type Route struct {
+	// Source path prefix the route matches
+	Source string `yaml:"source"`
+	// Target URL requests are proxied to
+	Target string `yaml:"target,omitempty"`
+	// Targets are the URLs requests are balanced across, instead of a single target
+	Targets []string `yaml:"targets,omitempty"`
+	// Balance configures how the requests are spread across the targets
+	Balance Balance `yaml:"balance,omitempty"`
+	// Static serves a local directory instead of proxying to a target
+	Static *Static `yaml:"static,omitempty"`
+	// Mock answers with the configured responses instead of proxying to a target
+	Mock *Mock `yaml:"mock,omitempty"`
+	// Record saves the requests and responses of the route to a file
+	Record *Record `yaml:"record,omitempty"`
+	// Replay answers with the responses recorded on a file. The requests without one are proxied to the target,
+	// if any
+	Replay *Replay `yaml:"replay,omitempty"`
+	// Faults are the failures and slowness injected into the requests of the route, to test how clients cope
+	Faults []Fault `yaml:"faults,omitempty"`
+	// AccessLog enables or disables the access log for the route. Defaults to the server access log setting
+	AccessLog *bool `yaml:"access-log,omitempty"`
+	// DialTimeout overrides the server transport dial timeout for the route
+	DialTimeout time.Duration `yaml:"dial-timeout,omitempty"`
+	// ResponseTimeout overrides the server transport response timeout for the route
+	ResponseTimeout time.Duration `yaml:"response-timeout,omitempty"`
+	// StripPrefix is removed from the start of the path. Defaults to the source
+	StripPrefix *string `yaml:"strip-prefix,omitempty"`
+	// AddPrefix is added to the start of the path after stripping and rewriting it. Defaults to the target path
+	AddPrefix *string `yaml:"add-prefix,omitempty"`
+	// Rewrite rules applied, in order, to the path after stripping the prefix
+	Rewrite []RewriteRule `yaml:"rewrite,omitempty"`
+	// Match holds extra conditions, besides the source, a request must meet to use the route
+	Match RouteMatch `yaml:"match,omitempty"`
+	// Streaming configures WebSocket and streaming responses, like server-sent events
+	Streaming Streaming `yaml:"streaming,omitempty"`
+	// Task serving the target, named <application>:<action> or just the application. Its state and latest output
+	// are shown on the error page when the target cannot be reached
+	Task string `yaml:"task,omitempty"`
+	// Health configures the active health checks of the target
+	Health HealthCheck `yaml:"health,omitempty"`
+	// Headers are the changes made to the headers of the requests and responses
+	Headers Headers `yaml:"headers,omitempty"`
+	// CORS answers the preflight requests and adds the CORS headers to the responses, overriding the ones of the
+	// target
+	CORS *CORS `yaml:"cors,omitempty"`
+	// Forwarded configures the headers telling the target about the original request
+	Forwarded Forwarded `yaml:"forwarded,omitempty"`
+}
+
+// Headers holds the changes made to the headers of a route. Values can include the {client_ip}, {route}, {host},
+// {method}, {path} and {scheme} placeholders, replaced with the ones of the request
+type Headers struct {
+	// Request changes the headers of the requests sent to the target
+	Request HeaderRules `yaml:"request,omitempty"`
+	// Response changes the headers of the responses sent to the client
+	Response HeaderRules `yaml:"response,omitempty"`
+}
+
+// HeaderRules holds the headers removed, set and added, applied in that order
+type HeaderRules struct {
+	// Remove deletes the headers
+	Remove []string `yaml:"remove,omitempty"`
+	// Set replaces the values of the headers
+	Set map[string]string `yaml:"set,omitempty"`
+	// Add appends a value to the headers, keeping the existing ones
+	Add map[string]string `yaml:"add,omitempty"`
+}
+
+// CORS holds the policy for the cross-origin requests of a route
+type CORS struct {
+	// AllowOrigins are the origins allowed, like http://localhost:3000. "*" allows any
+	AllowOrigins []string `yaml:"allow-origins"`
+	// AllowMethods are the methods allowed. Defaults to GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowMethods []string `yaml:"allow-methods,omitempty"`
+	// AllowHeaders are the request headers allowed. Defaults to the ones requested by the preflight request
+	AllowHeaders []string `yaml:"allow-headers,omitempty"`
+	// ExposeHeaders are the response headers the client can read, besides the safelisted ones
+	ExposeHeaders []string `yaml:"expose-headers,omitempty"`
+	// AllowCredentials allows sending cookies and credentials
+	AllowCredentials bool `yaml:"allow-credentials,omitempty"`
+	// MaxAge is how long the preflight response can be cached
+	MaxAge time.Duration `yaml:"max-age,omitempty"`
+}
+
+// Forwarded holds how the headers describing the original request are sent to the target
+type Forwarded struct {
+	// Trust keeps the X-Forwarded-* and Forwarded headers sent by the client, appending to them. They are
+	// replaced by default
+	Trust bool `yaml:"trust,omitempty"`
+	// XForwarded sets the X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto headers. Defaults to true
+	XForwarded *bool `yaml:"x-forwarded,omitempty"`
+	// Standard sets the Forwarded header of RFC 7239. Defaults to false
+	Standard bool `yaml:"standard,omitempty"`
+}
+
+// Static holds the configuration of a route serving a local directory, like the prebuilt dist folder of an app
+type Static struct {
+	// Dir is the directory served. A leading "~" is expanded to the user home directory, as on repository paths
+	Dir string `yaml:"dir"`
+	// Index is the file served for the directories. Defaults to index.html
+	Index string `yaml:"index,omitempty"`
+	// Fallback is the file, relative to the directory, served for the paths without extension not found, like
+	// index.html for single page applications using history routing. Not found is returned when empty
+	Fallback string `yaml:"fallback,omitempty"`
+	// CacheControl is the Cache-Control header of the responses. Defaults to no-cache
+	CacheControl string `yaml:"cache-control,omitempty"`
+	// Listing lists the files of the directories without index file. Disabled by default
+	Listing bool `yaml:"listing,omitempty"`
+}
+
+// Mock holds the responses of a route standing in for a backend not available
+type Mock struct {
+	// Responses are tried in order, the first one matching the request is sent
+	Responses []MockResponse `yaml:"responses"`
+}
+
+// MockResponse is a response of a mock route along with the requests it answers
+type MockResponse struct {
+	// Method of the request, any if empty
+	Method string `yaml:"method,omitempty"`
+	// Path of the request once stripped of the prefix. A ":name" segment matches any value and a trailing "*" the
+	// rest of the path. Any if empty
+	Path string `yaml:"path,omitempty"`
+	// Query parameters that must be present with the given value, or any value if empty
+	Query map[string]string `yaml:"query,omitempty"`
+	// Status of the response. Defaults to 200
+	Status int `yaml:"status,omitempty"`
+	// Headers of the response
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Body of the response. Text is sent as it is and anything else as JSON. Strings are Go templates
+	Body any `yaml:"body,omitempty"`
+	// File holds the body of the response, as a Go template. It is read on every request
+	File string `yaml:"file,omitempty"`
+	// Latency delays the response
+	Latency time.Duration `yaml:"latency,omitempty"`
+	// ErrorRate is the fraction of the requests, from 0 to 1, answered with ErrorStatus instead
+	ErrorRate float64 `yaml:"error-rate,omitempty"`
+	// ErrorStatus is the status of the failed responses. Defaults to 500
+	ErrorStatus int `yaml:"error-status,omitempty"`
+}
+
+// Record holds where and how the requests and responses of a route are recorded
+type Record struct {
+	// File the exchanges are saved to. A leading "~" is expanded to the user home directory
+	File string `yaml:"file"`
+	// Format of the file: jsonl, with a HAR entry per line, or har. Defaults to jsonl
+	Format string `yaml:"format,omitempty"`
+	// Redact are the headers whose values are not recorded. Defaults to Authorization, Proxy-Authorization,
+	// Cookie and Set-Cookie
+	Redact []string `yaml:"redact,omitempty"`
+	// MaxBodySize is the maximum number of bytes recorded of each body. Defaults to 1MB
+	MaxBodySize int64 `yaml:"max-body-size,omitempty"`
+}
+
+// Replay holds where the responses replayed by a route are and how they are matched
+type Replay struct {
+	// File with the recorded exchanges, as JSON lines or HAR. It is read again when it changes
+	File string `yaml:"file"`
+	// Match are the parts of the request compared with the recorded ones: method, path, query and body.
+	// Defaults to method, path and query
+	Match []string `yaml:"match,omitempty"`
+	// MatchHeaders are the headers compared with the recorded ones, besides the parts in Match
+	MatchHeaders []string `yaml:"match-headers,omitempty"`
+}
+
+// Fault is a failure or slowness injected into the requests of a route matching it
+type Fault struct {
+	// Method of the request, any if empty
+	Method string `yaml:"method,omitempty"`
+	// Path of the request once stripped of the prefix, matched as the path of the mock responses. Any if empty
+	Path string `yaml:"path,omitempty"`
+	// Latency delays the requests
+	Latency time.Duration `yaml:"latency,omitempty"`
+	// Jitter is the maximum random time added to the latency
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+	// Bandwidth limits the responses to the given bytes per second
+	Bandwidth int64 `yaml:"bandwidth,omitempty"`
+	// ErrorRate is the fraction of the requests, from 0 to 1, answered with ErrorStatus instead of being handled
+	ErrorRate float64 `yaml:"error-rate,omitempty"`
+	// ErrorStatus is the status of the failed responses. Defaults to 503
+	ErrorStatus int `yaml:"error-status,omitempty"`
+	// ResetRate is the fraction of the requests, from 0 to 1, whose connection is reset instead of being handled
+	ResetRate float64 `yaml:"reset-rate,omitempty"`
+	// Disabled keeps the fault in the configuration without injecting it
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// Balance holds the configuration of the load balancing of a route across its targets
+type Balance struct {
+	// Strategy picking the target of each request: round-robin, least-connections or random. Defaults to
+	// round-robin
+	Strategy string `yaml:"strategy,omitempty"`
+	// StickyCookie is the name of the cookie keeping each client on the same target. Not sticky when empty
+	StickyCookie string `yaml:"sticky-cookie,omitempty"`
+	// EjectAfter is the number of consecutive failures reaching a target after which it is left out. Defaults to 3
+	EjectAfter int `yaml:"eject-after,omitempty"`
+	// EjectFor is how long a failing target is left out. Defaults to 30s
+	EjectFor time.Duration `yaml:"eject-for,omitempty"`
+}
+
+// HealthCheck holds the configuration of the active health checks of a route target. Checks run when a path or
+// a wait is set
+type HealthCheck struct {
+	// Path requested on the target host, which is healthy when answering with a status below 500. The target is
+	// only connected to when empty
+	Path string `yaml:"path,omitempty"`
+	// Interval between checks. Defaults to 2s
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout of each check. Defaults to 1s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Wait holds the requests up to that long whilst the target is unhealthy, retrying the ones failing to
+	// connect once it becomes healthy. Requests are not held by default
+	Wait time.Duration `yaml:"wait,omitempty"`
+}
+
+// Streaming holds the configuration of long lived requests
+type Streaming struct {
+	// WebSocket allows Upgrade requests, used by WebSockets. Defaults to true
+	WebSocket *bool `yaml:"websocket,omitempty"`
+	// FlushInterval is how often the response is flushed to the client whilst copying it. A negative value
+	// flushes after each write. Server-sent events and responses of unknown length are always flushed
+	// after each write
+	FlushInterval time.Duration `yaml:"flush-interval,omitempty"`
+	// IdleTimeout closes upstream connections, including upgraded ones, without traffic for that long.
+	// No limit by default
+	IdleTimeout time.Duration `yaml:"idle-timeout,omitempty"`
+}
+
+// RouteMatch holds the conditions a request must meet to use a route
+type RouteMatch struct {
+	// Host of the request, without port. A leading "*." matches any subdomain, like "*.mybox.superdomain.com"
+	Host string `yaml:"host,omitempty"`
+	// Methods allowed, any if empty
+	Methods []string `yaml:"methods,omitempty"`
+	// Headers that must be present with the given value, or with any value if empty
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Query parameters that must be present with the given value, or with any value if empty
+	Query map[string]string `yaml:"query,omitempty"`
+}
+
+// RewriteRule replaces the parts of the path matching a regular expression
+type RewriteRule struct {
+	// Match is the regular expression to look for
+	Match string `yaml:"match"`
+	// Replace is the replacement, which can reference groups as $1 or ${name}
+	Replace string `yaml:"replace"`
+}
+
+// Transport holds the configuration of the connections to the upstreams
+type Transport struct {
+	// DialTimeout is the maximum time to connect to an upstream. Defaults to 5s
+	DialTimeout time.Duration `yaml:"dial-timeout,omitempty"`
+	// ResponseTimeout is the maximum time to wait for the upstream response headers. No limit by default
+	ResponseTimeout time.Duration `yaml:"response-timeout,omitempty"`
+	// IdleConnTimeout is how long idle connections are kept open. Defaults to 90s
+	IdleConnTimeout time.Duration `yaml:"idle-conn-timeout,omitempty"`
+	// MaxIdleConns is the maximum number of idle connections. Defaults to 100
+	MaxIdleConns int `yaml:"max-idle-conns,omitempty"`
+	// MaxIdleConnsPerHost is the maximum number of idle connections per upstream. Defaults to 32
+	MaxIdleConnsPerHost int `yaml:"max-idle-conns-per-host,omitempty"`
+}
+
+// AccessLog holds the configuration of the proxy access log
+type AccessLog struct {
+	// Enabled logs every proxied request
+	Enabled bool `yaml:"enabled"`
+	// Format of each entry: common, combined or json. Defaults to combined
+	Format string `yaml:"format,omitempty"`
+	// File to append the entries to. Defaults to the titan logs
+	File string `yaml:"file,omitempty"`
+}
+
+// Admin holds the configuration of the admin API and dashboard of serve
+type Admin struct {
+	// Host the admin server listens on. Defaults to 127.0.0.1
+	Host string `yaml:"host,omitempty"`
+	// Port the admin server listens on. The admin server is only started when set
+	Port int `yaml:"port,omitempty"`
+}
+
+// Metrics holds the configuration of the Prometheus metrics endpoint of serve
+type Metrics struct {
+	// Host the metrics server listens on. Defaults to 127.0.0.1
+	Host string `yaml:"host,omitempty"`
+	// Port the metrics server listens on. The metrics server is only started when set
+	Port int `yaml:"port,omitempty"`
+	// Path the metrics are served on. Defaults to /metrics
+	Path string `yaml:"path,omitempty"`
+}
+
+// SSL holds the HTTPS configuration of the proxy
+type SSL struct {
+	// Mode is http, https, both or redirect. Defaults to both when cert and key are provided, http otherwise
+	Mode string `yaml:"mode,omitempty"`
+	Port int    `yaml:"port"`
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// Auto issues the certificate from a local CA kept by titan, instead of using cert and key
+	Auto bool `yaml:"auto,omitempty"`
+	// SANs are the additional hosts, besides the server host, covered by the issued certificate
+	SANs []string `yaml:"sans,omitempty"`
+}
+
 type Server struct {
 	// Host value
 	Host string `yaml:"host"`
 	// Port value
 	Port int `yaml:"port"`
 	// SSL configuration
-	SSL struct {
-		Port int    `yaml:"port"`
-		Cert string `yaml:"cert"`
-		Key  string `yaml:"key"`
-	} `yaml:"ssl"`
+	SSL SSL `yaml:"ssl"`
 
 	// Routes to proxy to
-	Routes map[string]struct {
-		Source string `yaml:"source"`
-		Target string `yaml:"target"`
-	} `yaml:"routes"`
+	Routes map[string]Route `yaml:"routes"`
+
+	// AccessLog configuration
+	AccessLog AccessLog `yaml:"access-log,omitempty"`
+
+	// Transport configuration for the connections to the upstreams
+	Transport Transport `yaml:"transport,omitempty"`
+
+	// Admin configuration of the admin API and dashboard
+	Admin Admin `yaml:"admin,omitempty"`
+
+	// Metrics configuration of the Prometheus metrics endpoint
+	Metrics Metrics `yaml:"metrics,omitempty"`
 
 	Applications map[string]Application `yaml:"applications"`
 
@@ -56,18 +372,62 @@ type RepoCommands struct {
 	Condition string `yaml:"condition,omitempty"`
 }
 
+// RepoActionCache holds the inputs hashed to decide if an action can be skipped
+type RepoActionCache struct {
+	// Git hashes the HEAD commit plus the uncommitted and untracked changes
+	Git bool `yaml:"git,omitempty"`
+	// Lockfile hashes the package manager lockfile
+	Lockfile bool `yaml:"lockfile,omitempty"`
+	// Files hashes the files matching the glob patterns, relative to the repository
+	Files []string `yaml:"files,omitempty"`
+}
+
 type RepoAction struct {
-	Commands []RepoCommands `yaml:"commands"`
+	// Mode allows using a built-in implementation instead of the commands. Only "git" for fetch for now
+	Mode string `yaml:"mode,omitempty"`
+	// Cache skips the action when its inputs did not change since the last successful run
+	Cache    *RepoActionCache `yaml:"cache,omitempty"`
+	Commands []RepoCommands   `yaml:"commands"`
+}
+
+// Repository holds the data of a repository affected by the repository actions
+type Repository struct {
+	// Path where the repository is, or will be cloned to
+	Path string `yaml:"path"`
+	// Remote URL used to clone the repository when missing
+	Remote string `yaml:"remote,omitempty"`
+	// Branch to checkout when cloning. Defaults to the remote default branch
+	Branch string `yaml:"branch,omitempty"`
+}
+
+// UnmarshalYAML allows declaring a repository just with its path
+func (r *Repository) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		r.Path = value.Value
+		return nil
+	}
+	type plain Repository
+	return value.Decode((*plain)(r))
 }
 
 type RepoActions struct {
 	// map[string]RepoAction
 	// List of respositories
 	ScriptsOutput string                 `yaml:"scripts-output,omitempty"`
-	Repositories  map[string]string      `yaml:"repositories"`
+	Repositories  map[string]Repository  `yaml:"repositories"`
 	Actions       map[string]*RepoAction `yaml:"actions"`
 }
 
+// Logging holds the logging configuration
+type Logging struct {
+	// Level is the minimum level logged: debug, info, warn or error. Defaults to info
+	Level string `yaml:"level,omitempty"`
+	// Format of the logs: text, json or pretty. Defaults to pretty
+	Format string `yaml:"format,omitempty"`
+	// File to append the logs to instead of stderr
+	File string `yaml:"file,omitempty"`
+}
+
 // Config struct for titan
 type Config struct {
 	Versions Versions `yaml:"versions"`
@@ -77,4 +437,7 @@ type Config struct {
 
 	// Proxy server configuration
 	Server Server `yaml:"server"`
+
+	// Logging configuration
+	Logging Logging `yaml:"logging,omitempty"`
 }